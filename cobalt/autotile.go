@@ -0,0 +1,263 @@
+package cobalt
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+/*
+Autotiling turns a logical terrain grid (grass, water, wall...) into the atlas tiles of a `TileLayerNode`.
+
+Every cell looks at its 8 neighbours and builds a bitmask of the ones with the same terrain. A rule set maps that
+mask to an atlas tile. When a cell changes at runtime only it and its neighbours are re-evaluated, and only that
+region of the layer texture is re-uploaded.
+*/
+
+// neighbour bits used in autotile masks
+const (
+	AUTOTILE_N  = 1 << 0
+	AUTOTILE_NE = 1 << 1
+	AUTOTILE_E  = 1 << 2
+	AUTOTILE_SE = 1 << 3
+	AUTOTILE_S  = 1 << 4
+	AUTOTILE_SW = 1 << 5
+	AUTOTILE_W  = 1 << 6
+	AUTOTILE_NW = 1 << 7
+)
+
+// neighbour offsets, in the same order as the mask bits
+var autotileNeighbours = [8][2]int{
+	{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1},
+}
+
+// AutotileRules picks the atlas tile for a cell from its terrain and neighbour mask
+type AutotileRules interface {
+	Resolve(terrain uint8, mask uint8) (atlas [2]int, ok bool)
+}
+
+// 47 tile "blob" set. corners only count when both of their adjacent edges are connected, which reduces
+// the 256 possible masks to 47. tiles are laid out in ascending order of the reduced mask, Columns wide,
+// starting at Origin in the atlas.
+type Blob47Rules struct {
+	Origin  [2]int
+	Columns int
+}
+
+func (r *Blob47Rules) Resolve(terrain uint8, mask uint8) ([2]int, bool) {
+	return autotileAtlasCell(r.Origin, r.Columns, blob47Index[reduceBlobMask(mask)]), true
+}
+
+// 16 tile wang (edge) set. only the 4 edges are considered, index = N | E<<1 | S<<2 | W<<3,
+// laid out Columns wide starting at Origin in the atlas.
+type Wang16Rules struct {
+	Origin  [2]int
+	Columns int
+}
+
+func (r *Wang16Rules) Resolve(terrain uint8, mask uint8) ([2]int, bool) {
+	idx := 0
+	if mask&AUTOTILE_N != 0 {
+		idx |= 1
+	}
+	if mask&AUTOTILE_E != 0 {
+		idx |= 2
+	}
+	if mask&AUTOTILE_S != 0 {
+		idx |= 4
+	}
+	if mask&AUTOTILE_W != 0 {
+		idx |= 8
+	}
+	return autotileAtlasCell(r.Origin, r.Columns, idx), true
+}
+
+// a user rule matches when (mask & Care) == Match
+type AutotileRule struct {
+	Match uint8
+	Care  uint8
+	Tile  [2]int
+}
+
+// user rules are tested in order, the first match wins
+type UserRules []AutotileRule
+
+func (r UserRules) Resolve(terrain uint8, mask uint8) ([2]int, bool) {
+	for _, rule := range r {
+		if mask&rule.Care == rule.Match {
+			return rule.Tile, true
+		}
+	}
+	return [2]int{}, false
+}
+
+type Autotiler struct {
+	Layer *TileLayerNode
+	Cols  int
+	Rows  int
+
+	// rule set for each terrain. terrain 0 is empty and never drawn
+	Rules map[uint8]AutotileRules
+
+	// when true, cells past the edge of the map count as connected, so terrain runs cleanly off screen
+	EdgeConnects bool
+
+	terrain []uint8
+}
+
+// evaluate every cell of the terrain grid (Cols * Rows, row major) and upload the result to Layer
+func (a *Autotiler) Build(c *State, terrain []uint8) error {
+	if a.Cols <= 0 || a.Rows <= 0 {
+		return errors.New("autotiler needs a positive Cols and Rows")
+	}
+	if len(terrain) != a.Cols*a.Rows {
+		return errors.New("terrain grid size doesn't match Cols * Rows")
+	}
+	if a.Layer == nil {
+		return errors.New("autotiler needs a Layer")
+	}
+
+	a.terrain = append(a.terrain[:0], terrain...)
+
+	cells := image.NewRGBA(image.Rect(0, 0, a.Cols, a.Rows))
+	draw.Draw(cells, cells.Bounds(), &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 0, A: 255}}, image.Point{}, draw.Src)
+
+	for y := 0; y < a.Rows; y++ {
+		for x := 0; x < a.Cols; x++ {
+			if tile, ok := a.resolve(x, y); ok {
+				off := cells.PixOffset(x, y)
+				cells.Pix[off+0] = uint8(tile[0])
+				cells.Pix[off+1] = uint8(tile[1])
+			}
+		}
+	}
+
+	return a.Layer.SetCells(c, cells)
+}
+
+func (a *Autotiler) Terrain(x int, y int) uint8 {
+	if x < 0 || y < 0 || x >= a.Cols || y >= a.Rows || a.terrain == nil {
+		return 0
+	}
+	return a.terrain[y*a.Cols+x]
+}
+
+// change one cell's terrain, re-evaluating it and its 8 neighbours
+func (a *Autotiler) SetTerrain(c *State, x int, y int, terrain uint8) error {
+	if a.terrain == nil {
+		return errors.New("autotiler must be built before cells can change")
+	}
+	if err := a.checkLayer(); err != nil {
+		return err
+	}
+	if x < 0 || y < 0 || x >= a.Cols || y >= a.Rows {
+		return errors.New("terrain cell out of bounds")
+	}
+	if a.terrain[y*a.Cols+x] == terrain {
+		return nil
+	}
+
+	a.terrain[y*a.Cols+x] = terrain
+
+	dirty := image.Rect(x-1, y-1, x+2, y+2).Intersect(image.Rect(0, 0, a.Cols, a.Rows))
+
+	for cy := dirty.Min.Y; cy < dirty.Max.Y; cy++ {
+		for cx := dirty.Min.X; cx < dirty.Max.X; cx++ {
+			if tile, ok := a.resolve(cx, cy); ok {
+				a.Layer.putCell(cx, cy, uint8(tile[0]), uint8(tile[1]))
+			} else {
+				a.Layer.putCell(cx, cy, 255, 255)
+			}
+		}
+	}
+
+	return a.Layer.uploadCells(c, dirty)
+}
+
+// the layer must still hold the grid Build gave it, SetCells or SetTexture may have replaced it since
+func (a *Autotiler) checkLayer() error {
+	if a.Layer == nil || a.Layer.Cells == nil {
+		return errors.New("autotiler needs a Layer with cells")
+	}
+	if b := a.Layer.Cells.Bounds(); b.Dx() != a.Cols || b.Dy() != a.Rows {
+		return fmt.Errorf("autotiler is %dx%d but its layer has %dx%d cells", a.Cols, a.Rows, b.Dx(), b.Dy())
+	}
+	return nil
+}
+
+// the neighbour mask for cell (x, y)
+func (a *Autotiler) Mask(x int, y int) uint8 {
+	terrain := a.Terrain(x, y)
+
+	var mask uint8
+	for i, n := range autotileNeighbours {
+		nx, ny := x+n[0], y+n[1]
+
+		if nx < 0 || ny < 0 || nx >= a.Cols || ny >= a.Rows {
+			if a.EdgeConnects {
+				mask |= 1 << i
+			}
+			continue
+		}
+
+		if a.Terrain(nx, ny) == terrain {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+func (a *Autotiler) resolve(x int, y int) ([2]int, bool) {
+	terrain := a.Terrain(x, y)
+	if terrain == 0 {
+		return [2]int{}, false
+	}
+
+	rules := a.Rules[terrain]
+	if rules == nil {
+		return [2]int{}, false
+	}
+
+	return rules.Resolve(terrain, a.Mask(x, y))
+}
+
+func autotileAtlasCell(origin [2]int, columns int, idx int) [2]int {
+	if columns <= 0 {
+		return [2]int{origin[0] + idx, origin[1]}
+	}
+	return [2]int{origin[0] + idx%columns, origin[1] + idx/columns}
+}
+
+// drop corner bits whose adjacent edges aren't both set
+func reduceBlobMask(mask uint8) uint8 {
+	if mask&AUTOTILE_N == 0 || mask&AUTOTILE_E == 0 {
+		mask &^= AUTOTILE_NE
+	}
+	if mask&AUTOTILE_S == 0 || mask&AUTOTILE_E == 0 {
+		mask &^= AUTOTILE_SE
+	}
+	if mask&AUTOTILE_S == 0 || mask&AUTOTILE_W == 0 {
+		mask &^= AUTOTILE_SW
+	}
+	if mask&AUTOTILE_N == 0 || mask&AUTOTILE_W == 0 {
+		mask &^= AUTOTILE_NW
+	}
+	return mask
+}
+
+// reduced blob mask -> tile index (0..46)
+var blob47Index = buildBlob47Index()
+
+func buildBlob47Index() [256]int {
+	var idx [256]int
+	n := 0
+	for m := 0; m < 256; m++ {
+		if reduceBlobMask(uint8(m)) == uint8(m) {
+			idx[m] = n
+			n++
+		}
+	}
+	return idx
+}
@@ -0,0 +1,112 @@
+package cobalt
+
+import (
+	"image"
+	"testing"
+)
+
+func TestBlob47Index(t *testing.T) {
+	seen := make(map[int]bool)
+	for m := 0; m < 256; m++ {
+		reduced := reduceBlobMask(uint8(m))
+		if reduceBlobMask(reduced) != reduced {
+			t.Fatalf("reducing %08b twice changed it", m)
+		}
+		seen[blob47Index[reduced]] = true
+	}
+
+	if len(seen) != 47 {
+		t.Fatalf("%d distinct tiles, want 47", len(seen))
+	}
+	for i := 0; i < 47; i++ {
+		if !seen[i] {
+			t.Errorf("tile %d is never used", i)
+		}
+	}
+}
+
+func TestAutotileRules(t *testing.T) {
+	blob := &Blob47Rules{Origin: [2]int{1, 2}, Columns: 8}
+	wang := &Wang16Rules{Origin: [2]int{0, 4}, Columns: 4}
+
+	tests := []struct {
+		name  string
+		rules AutotileRules
+		mask  uint8
+		tile  [2]int
+	}{
+		{"blob, isolated", blob, 0, [2]int{1, 2}},
+		{"blob, N E and the corner between them", blob, AUTOTILE_N | AUTOTILE_NE | AUTOTILE_E, [2]int{5, 2}},
+		{"blob, a corner without both edges is dropped", blob, AUTOTILE_NE | AUTOTILE_E, [2]int{3, 2}},
+		{"blob, surrounded", blob, 0xff, [2]int{7, 7}},
+		{"wang, N and S", wang, AUTOTILE_N | AUTOTILE_S, [2]int{1, 5}},
+		{"wang, corners are ignored", wang, AUTOTILE_N | AUTOTILE_S | AUTOTILE_NE | AUTOTILE_SW, [2]int{1, 5}},
+		{"wang, all edges", wang, AUTOTILE_N | AUTOTILE_E | AUTOTILE_S | AUTOTILE_W, [2]int{3, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, ok := tt.rules.Resolve(1, tt.mask)
+			if !ok || tile != tt.tile {
+				t.Errorf("Resolve(%08b) = %v, %v, want %v", tt.mask, tile, ok, tt.tile)
+			}
+		})
+	}
+}
+
+func TestAutotilerMask(t *testing.T) {
+	// 1 1 0
+	// 1 1 0
+	// 0 0 2
+	a := &Autotiler{Cols: 3, Rows: 3, terrain: []uint8{1, 1, 0, 1, 1, 0, 0, 0, 2}}
+
+	if got, want := a.Mask(0, 0), uint8(AUTOTILE_E|AUTOTILE_SE|AUTOTILE_S); got != want {
+		t.Errorf("Mask(0, 0) = %08b, want %08b", got, want)
+	}
+	if got, want := a.Mask(2, 2), uint8(0); got != want {
+		t.Errorf("Mask(2, 2) = %08b, want %08b", got, want)
+	}
+
+	a.EdgeConnects = true
+	if got, want := a.Mask(2, 2), uint8(AUTOTILE_SE|AUTOTILE_E|AUTOTILE_NE|AUTOTILE_S|AUTOTILE_SW); got != want {
+		t.Errorf("Mask(2, 2) with EdgeConnects = %08b, want %08b", got, want)
+	}
+}
+
+func TestAutotilerBeforeBuild(t *testing.T) {
+	a := &Autotiler{Cols: 3, Rows: 3}
+
+	// every cell reads as terrain 0 until Build, so they're all connected
+	if got := a.Mask(1, 1); got != 0xff {
+		t.Errorf("Mask(1, 1) before Build = %08b, want %08b", got, 0xff)
+	}
+	if a.SetTerrain(&State{}, 1, 1, 1) == nil {
+		t.Error("SetTerrain before Build succeeded")
+	}
+}
+
+func TestAutotilerLayerSize(t *testing.T) {
+	layer := &TileLayerNode{Cells: image.NewRGBA(image.Rect(0, 0, 2, 2))}
+	a := &Autotiler{Layer: layer, Cols: 3, Rows: 3, terrain: make([]uint8, 9)}
+
+	if a.SetTerrain(&State{}, 1, 1, 1) == nil {
+		t.Error("SetTerrain on a layer smaller than the terrain grid succeeded")
+	}
+	if a.Terrain(1, 1) != 0 {
+		t.Error("failed SetTerrain changed the terrain grid")
+	}
+}
+
+func TestTileLayerWatchesUntilEdited(t *testing.T) {
+	l := &TileLayerNode{TexturePath: "map.png", Cells: image.NewRGBA(image.Rect(0, 0, 2, 2))}
+	if got := l.WatchedFiles(nil); len(got) != 1 {
+		t.Fatalf("WatchedFiles() = %v, want the texture path", got)
+	}
+
+	if err := l.SetTile(&State{}, 0, 0, [2]int{1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.WatchedFiles(nil); len(got) != 0 {
+		t.Errorf("WatchedFiles() after SetTile = %v, want nothing so a reload can't overwrite the edit", got)
+	}
+}
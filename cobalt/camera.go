@@ -0,0 +1,181 @@
+package cobalt
+
+import (
+	"image"
+	"math"
+)
+
+/*
+Camera drives the viewport from a target the game updates every frame (usually the player position):
+
+	cam := &cobalt.Camera{Follow: cobalt.FollowSpring, Frequency: 8, Deadzone: [2]float32{24, 16}}
+	cam.Bounds = cobalt.MapBounds(atlas, [2]int{cols, rows})
+
+	// each frame
+	cam.Target = player.Position
+	cam.Update(c, dt)
+
+Call AddTrauma when something hits hard; the view shakes by the square of the trauma, which decays over time.
+
+A camera given to a View (see AddView) only moves that view and leaves c.Viewport alone.
+*/
+
+type CameraFollow int
+
+const (
+	FollowLerp   CameraFollow = iota // exponential ease toward the target, at Speed
+	FollowSpring                     // critically damped spring, at Frequency. never overshoots
+)
+
+type Camera struct {
+	Position [2]float32 // center of the view, in world pixels
+	Target   [2]float32 // the point being followed
+
+	Follow    CameraFollow
+	Speed     float32 // FollowLerp rate per second. 0 snaps to the target
+	Frequency float32 // FollowSpring stiffness in radians per second. 0 snaps to the target
+
+	// half size of the box around Position the target can move in without the camera following
+	Deadzone [2]float32
+
+	// world area the view is kept inside, in world pixels. an empty rectangle means unbounded
+	Bounds image.Rectangle
+
+	Trauma     float32    // 0..1, see AddTrauma
+	ShakeMax   [2]float32 // view offset in world pixels at full trauma
+	ShakeDecay float32    // trauma lost per second
+	ShakeSpeed float32    // how fast the shake moves. defaults to 20
+
+	velocity  [2]float32 // FollowSpring state
+	shakeTime float64
+	shake     [2]float32
+	view      *View // set by AddView
+}
+
+// advance the camera by dt seconds and move the viewport to it
+func (cam *Camera) Update(c *State, dt float32) error {
+	desired := cam.Position
+	for i := 0; i < 2; i++ {
+		d := cam.Target[i] - cam.Position[i]
+		if d > cam.Deadzone[i] {
+			desired[i] = cam.Target[i] - cam.Deadzone[i]
+		} else if d < -cam.Deadzone[i] {
+			desired[i] = cam.Target[i] + cam.Deadzone[i]
+		}
+	}
+
+	switch cam.Follow {
+	case FollowSpring:
+		cam.Position, cam.velocity = springDamp(cam.Position, cam.velocity, desired, cam.Frequency, dt)
+	default:
+		if cam.Speed <= 0 {
+			cam.Position = desired
+		} else {
+			t := 1 - float32(math.Exp(float64(-cam.Speed*dt)))
+			cam.Position[0] += (desired[0] - cam.Position[0]) * t
+			cam.Position[1] += (desired[1] - cam.Position[1]) * t
+		}
+	}
+
+	cam.Position = cam.clamp(c, cam.Position)
+	cam.updateShake(dt)
+
+	// a view reads the camera when it renders
+	if cam.view != nil {
+		return nil
+	}
+
+	// rounding to pixels is left to Viewport.Snap
+	return SetViewportPosition(c, cam.center())
+}
+
+// jump straight to the target, e.g. after loading a level
+func (cam *Camera) Snap(c *State) error {
+	cam.Position = cam.Target
+	cam.velocity = [2]float32{}
+	return cam.Update(c, 0)
+}
+
+// add screen shake. trauma is capped at 1
+func (cam *Camera) AddTrauma(amount float32) {
+	cam.Trauma = min(cam.Trauma+amount, 1)
+}
+
+// the current shake offset, in world pixels
+func (cam *Camera) Shake() [2]float32 {
+	return cam.shake
+}
+
+// the point the view is centered on, shake included
+func (cam *Camera) center() [2]float32 {
+	return [2]float32{cam.Position[0] + cam.shake[0], cam.Position[1] + cam.shake[1]}
+}
+
+// world bounds of a tile map cols x rows tiles in size, for Camera.Bounds
+func MapBounds(atlas *TileAtlasNode, size [2]int) image.Rectangle {
+	ts := atlas.tileWorldSize()
+	return image.Rect(0, 0, int(float32(size[0])*ts), int(float32(size[1])*ts))
+}
+
+// keep the view inside Bounds. a view wider (or taller) than the bounds is centered on them
+func (cam *Camera) clamp(c *State, pos [2]float32) [2]float32 {
+	if cam.Bounds.Empty() {
+		return pos
+	}
+
+	vp := c.Viewport
+	if cam.view != nil {
+		vp = cam.view.viewport(vp)
+	}
+
+	size := vp.worldSize()
+	half := [2]float32{size[0] / 2, size[1] / 2}
+	lo := [2]float32{float32(cam.Bounds.Min.X), float32(cam.Bounds.Min.Y)}
+	hi := [2]float32{float32(cam.Bounds.Max.X), float32(cam.Bounds.Max.Y)}
+
+	for i := 0; i < 2; i++ {
+		if hi[i]-lo[i] <= half[i]*2 {
+			pos[i] = (lo[i] + hi[i]) / 2
+			continue
+		}
+		pos[i] = min(max(pos[i], lo[i]+half[i]), hi[i]-half[i])
+	}
+	return pos
+}
+
+func (cam *Camera) updateShake(dt float32) {
+	cam.Trauma = max(cam.Trauma-cam.ShakeDecay*dt, 0)
+
+	speed := cam.ShakeSpeed
+	if speed <= 0 {
+		speed = 20
+	}
+	cam.shakeTime += float64(dt * speed)
+
+	amount := cam.Trauma * cam.Trauma
+	cam.shake[0] = cam.ShakeMax[0] * amount * shakeNoise(cam.shakeTime, 0)
+	cam.shake[1] = cam.ShakeMax[1] * amount * shakeNoise(cam.shakeTime, 1)
+}
+
+// smooth noise in -1..1. a few incommensurate sines, so the shake doesn't visibly repeat
+func shakeNoise(t float64, axis int) float32 {
+	o := float64(axis) * 17.3
+	n := math.Sin(t+o)*0.5 + math.Sin(t*2.17+o*1.3)*0.3 + math.Sin(t*4.73+o*0.7)*0.2
+	return float32(n)
+}
+
+// one step of a critically damped spring toward target, exact for any dt
+func springDamp(pos [2]float32, vel [2]float32, target [2]float32, omega float32, dt float32) ([2]float32, [2]float32) {
+	if omega <= 0 {
+		return target, [2]float32{}
+	}
+
+	decay := float32(math.Exp(float64(-omega * dt)))
+	for i := 0; i < 2; i++ {
+		x := pos[i] - target[i]
+		temp := (vel[i] + omega*x) * dt
+		vel[i] = (vel[i] - omega*temp) * decay
+		pos[i] = target[i] + (x+temp)*decay
+	}
+	return pos, vel
+}
@@ -1,8 +1,8 @@
 package cobalt
 
 import (
-	"fmt"
-	//"math"
+	"log/slog"
+	"math"
 	//"math/rand"
 	"os"
 	"runtime"
@@ -24,11 +24,22 @@ type State struct {
 	// Reference to the GLFW window for framebuffer size queries
 	window *glfw.Window
 
+	// physical pixels per logical point, see ContentScale
+	contentScale [2]float32
+
+	// what the surface supports, queried once in Init
+	caps wgpu.SurfaceCapabilities
+
 	// some nodes may need a reference to the default texture view (the frame backing)
 	// this is generated each frame
 	surfaceTexView *wgpu.TextureView
 
-	nodeDefs map[string]NodeDefinition
+	// node constructors by type string, see DefineNode
+	nodeTypes map[string]NodeFactory
+
+	// nodes created with InitNode, by name and in declaration order
+	graph      map[string]*NodeInstance
+	graphOrder []*NodeInstance
 
 	// used in the color attachments of renderpass
 	// clearValue: { r: 0.0, g: 0.0, b: 0.0, a: 1.0 },
@@ -36,19 +47,50 @@ type State struct {
 	// runnable nodes. ordering dictates render order (first to last)
 	Nodes    []NodeDefinition
 	Viewport Viewport
+
+	// what Draw does when a node fails. defaults to ErrorPolicySkip, see SetNodeErrorPolicy for per-node overrides
+	ErrorPolicy  ErrorPolicy
+	nodePolicies map[NodeDefinition]ErrorPolicy
+
+	// nodes turned off by ErrorPolicyDisable that don't implement NodeToggle
+	failed map[NodeDefinition]bool
+
+	// live GPU resources per node, see LiveResources
+	resources resourceTracker
+
+	// true while Draw runs the nodes, so the graph can't be changed under it
+	drawing bool
+
+	// split-screen views, see AddView. while one renders, activeView is set and viewBase holds the main viewport
+	views      []*View
+	activeView *View
+	viewIndex  int
+	viewBase   Viewport
+
+	// dev mode file watching, see EnableHotReload
+	hotReload *hotReloader
+
+	// per-node timings, see EnableProfiling
+	profiler *profiler
+
+	// diagnostics from cobalt and wgpu. nil keeps the library silent
+	Logger *slog.Logger
 }
 
 type NodeOptions struct {
-	nodeType string
-	payload  any
+	Type    string            // node type, e.g. "cobalt:tile"
+	Name    string            // unique name other nodes use to reference this one
+	Refs    map[string]string // ref name (e.g. "tileAtlas") -> name of the referenced node
+	Options map[string]any    // passed to the factory registered for Type
+	Node    NodeDefinition    // an already constructed node. when set, Options is not used
 }
 
 type NodeInstance struct {
+	Name       string
 	nodeType   string
-	refs       []int
-	options    map[string]string
-	data       any
-	enabled    bool           // when disabled, the node won't be run
+	refs       map[string]string
+	options    map[string]any
+	ready      bool           // refs are resolved and Init has run
 	definition NodeDefinition // the implementation of the node
 }
 
@@ -63,19 +105,67 @@ type NodeDefinition interface {
 }
 
 type Viewport struct {
-	width    int
-	height   int
-	Zoom     int
-	position [2]int // top-left corner of the viewport
+	width  int
+	height int
+	Zoom   float32 // viewport pixels per world pixel. fractional values zoom smoothly, 0 is treated as 1
+	Snap   PixelSnap
+
+	center [2]float32 // world position at the middle of the view, as passed to SetViewportPosition
+}
+
+// how the view position is rounded before it reaches the shaders
+type PixelSnap int
+
+const (
+	SnapWorldPixel  PixelSnap = iota // whole world pixels. pixel art stays crisp, scrolling moves in steps of Zoom
+	SnapScreenPixel                  // whole viewport pixels. smooth scrolling at Zoom > 1 without shimmering
+	SnapNone                         // no rounding. smoothest, but texels may shimmer while moving
+)
+
+func (v *Viewport) zoom() float32 {
+	if v.Zoom <= 0 {
+		return 1
+	}
+	return v.Zoom
+}
+
+// size of the visible area in world pixels
+func (v *Viewport) worldSize() [2]float32 {
+	z := v.zoom()
+	return [2]float32{float32(v.width) / z, float32(v.height) / z}
+}
+
+// top-left visible corner in world pixels, rounded according to Snap
+func (v *Viewport) position() [2]float32 {
+	size := v.worldSize()
+	pos := [2]float32{v.center[0] - size[0]/2, v.center[1] - size[1]/2}
+
+	switch v.Snap {
+	case SnapWorldPixel:
+		pos[0] = float32(math.Round(float64(pos[0])))
+		pos[1] = float32(math.Round(float64(pos[1])))
+	case SnapScreenPixel:
+		z := float64(v.zoom())
+		pos[0] = float32(math.Round(float64(pos[0])*z) / z)
+		pos[1] = float32(math.Round(float64(pos[1])*z) / z)
+	}
+	return pos
 }
 
 // create and initialize a WebGPU renderer for a given glfw window
 // returns the data structure containing all WebGPU related stuff
 func Init(window *glfw.Window, viewportWidth int, viewportHeight int) (s *State, err error) {
+	return InitWithOptions(window, viewportWidth, viewportHeight, SurfaceOptions{})
+}
+
+// Init with a choice of present mode and surface format, see SurfaceOptions
+func InitWithOptions(window *glfw.Window, viewportWidth int, viewportHeight int, opts SurfaceOptions) (s *State, err error) {
 	s = &State{}
 
 	runtime.LockOSThread()
 
+	forwardWgpuLog(s)
+
 	switch os.Getenv("WGPU_LOG_LEVEL") {
 	case "OFF":
 		wgpu.SetLogLevel(wgpu.LogLevelOff)
@@ -107,13 +197,25 @@ func Init(window *glfw.Window, viewportWidth int, viewportHeight int) (s *State,
 	}
 	defer s.adapter.Release()
 
-	s.Device, err = s.adapter.RequestDevice(nil)
+	// timestamp queries cost nothing until EnableProfiling uses them
+	var features []wgpu.FeatureName
+	if s.adapter.HasFeature(wgpu.FeatureNameTimestampQuery) {
+		features = append(features, wgpu.FeatureNameTimestampQuery)
+	}
+
+	s.Device, err = s.adapter.RequestDevice(&wgpu.DeviceDescriptor{RequiredFeatures: features})
 	if err != nil {
 		return s, err
 	}
 	s.Queue = s.Device.GetQueue()
 
-	caps := s.surface.GetCapabilities(s.adapter)
+	// the adapter is released when Init returns, so the capabilities are kept for SetSurfaceOptions
+	s.caps = s.surface.GetCapabilities(s.adapter)
+
+	format, presentMode, err := chooseSurface(s.caps, opts)
+	if err != nil {
+		return s, err
+	}
 
 	// Use GetFramebufferSize() for physical pixels, not GetSize() which returns logical points.
 	// On high-DPI displays (e.g., Retina), the framebuffer is larger than the logical window size.
@@ -122,49 +224,135 @@ func Init(window *glfw.Window, viewportWidth int, viewportHeight int) (s *State,
 
 	s.Config = &wgpu.SurfaceConfiguration{
 		Usage:       wgpu.TextureUsageRenderAttachment,
-		Format:      wgpu.TextureFormatBGRA8Unorm, //wgpu.TextureFormatRGBA16Float
+		Format:      format,
 		Width:       uint32(fbWidth),
 		Height:      uint32(fbHeight),
-		PresentMode: wgpu.PresentModeFifo, //wgpu.PresentModeImmediate, // wgpu.PresentModeFifo,
-		AlphaMode:   caps.AlphaModes[0],
+		PresentMode: presentMode,
+		AlphaMode:   s.caps.AlphaModes[0],
 	}
 
 	s.surface.Configure(s.adapter, s.Device, s.Config)
 
 	// Store window reference for framebuffer size queries during resize
 	s.window = window
+	watchWindow(s)
+
+	defineBuiltinNodes(s)
 
 	return s, nil
 }
 
-func DefineNode(c *State, nodeDefinition NodeDefinition) {
-	key := nodeDefinition.GetType()
-	c.nodeDefs[key] = nodeDefinition
+// register a node constructor for a type string, so InitNode (and scene files) can create nodes of
+// that type from options. third-party node packages call this to plug in their own types.
+// defining an existing type replaces its factory.
+func DefineNode(c *State, nodeType string, factory NodeFactory) {
+	if c.nodeTypes == nil {
+		c.nodeTypes = make(map[string]NodeFactory)
+	}
+	c.nodeTypes[nodeType] = factory
+}
+
+// true if a factory is registered for nodeType
+func IsNodeDefined(c *State, nodeType string) bool {
+	_, ok := c.nodeTypes[nodeType]
+	return ok
+}
+
+func defineBuiltinNodes(c *State) {
+	DefineNode(c, "cobalt:sprite", newSpriteNode)
+	DefineNode(c, "cobalt:tile", newTileLayerNode)
+	DefineNode(c, "cobalt:tileChunked", newChunkedTileLayerNode)
+	DefineNode(c, "cobalt:tileAtlas", newTileAtlasNode)
+	DefineNode(c, "cobalt:spritesheet", newSpritesheetNode)
+	DefineNode(c, "cobalt:framebuffer", newFrameBufferNode)
+	DefineNode(c, "cobalt:blit", newBlitNode)
+	DefineNode(c, "cobalt:upscale", newUpscaleNode)
+	DefineNode(c, "cobalt:profilerOverlay", newProfilerOverlayNode)
 }
 
 func Draw(c *State) error {
-	nextTexture, err := c.surface.GetCurrentTexture()
+	pollHotReload(c)
+
+	f, err := acquireFrame(c)
 	if err != nil {
 		return err
 	}
-	view, err := nextTexture.CreateView(nil)
-	if err != nil {
+
+	return drawFrame(c, f, func(view *wgpu.TextureView, errs *NodeErrors) error {
+		if len(c.views) == 0 {
+			return submitNodes(c, c.Nodes, view, errs)
+		}
+		return drawViews(c, view, errs)
+	})
+}
+
+// run the nodes into an acquired frame. the frame is always presented, an abandoned one cleared, since the
+// surface won't hand out another texture until it is
+func drawFrame(c *State, f frame, run func(view *wgpu.TextureView, errs *NodeErrors) error) error {
+	c.surfaceTexView = f.view()
+	defer func() {
+		c.surfaceTexView = nil
+		f.release()
+	}()
+
+	// abandoned frames drop their timings
+	beginProfile(c)
+	submitted := false
+	defer func() { endProfile(c, submitted) }()
+
+	// run all enabled nodes
+	c.drawing = true
+	defer func() { c.drawing = false }()
+
+	var errs NodeErrors
+	if err := run(f.view(), &errs); err != nil {
+		f.present(c, true)
 		return err
 	}
-	c.surfaceTexView = view
 
-	defer view.Release()
+	f.present(c, false)
+	submitted = true
 
+	return errs.err()
+}
+
+// run nodes into one command buffer and submit it. failures are collected in errs; a non-nil return means the
+// frame was abandoned (ErrorPolicyAbort, or the encoder failed)
+func submitNodes(c *State, nodes []NodeDefinition, view *wgpu.TextureView, errs *NodeErrors) error {
 	commandEncoder, err := c.Device.CreateCommandEncoder(nil)
 	if err != nil {
 		return err
 	}
 	defer commandEncoder.Release()
 
-	// run all enabled nodes
-	for _, n := range c.Nodes {
-		if n.IsEnabled() {
-			n.OnRun(c, commandEncoder, view)
+	for _, n := range nodes {
+		if !n.IsEnabled() || c.failed[n] {
+			continue
+		}
+
+		start := profileBegin(c, commandEncoder)
+		err := n.OnRun(c, commandEncoder, view)
+		profileEnd(c, commandEncoder, n, start)
+		if err == nil {
+			continue
+		}
+
+		*errs = append(*errs, newNodeError(c, n, PhaseRun, err))
+
+		switch errorPolicy(c, n) {
+		case ErrorPolicyDisable:
+			if t, ok := n.(NodeToggle); ok {
+				if err := t.SetEnabled(c, false); err != nil {
+					*errs = append(*errs, newNodeError(c, n, PhaseRun, err))
+				}
+				break
+			}
+			if c.failed == nil {
+				c.failed = make(map[NodeDefinition]bool)
+			}
+			c.failed[n] = true
+		case ErrorPolicyAbort:
+			return *errs
 		}
 	}
 
@@ -175,16 +363,29 @@ func Draw(c *State) error {
 	defer cmdBuffer.Release()
 
 	c.Queue.Submit(cmdBuffer)
-	c.surface.Present()
-
 	return nil
 }
 
-func Reset(c *State) {
+// re-enable a node that ErrorPolicyDisable turned off
+func ResumeNode(c *State, n NodeDefinition) error {
+	if c.failed[n] {
+		delete(c.failed, n)
+		return nil
+	}
+	return SetNodeEnabled(c, n, true)
+}
+
+func Reset(c *State) error {
+	var errs NodeErrors
 	for _, n := range c.Nodes {
-		n.OnDestroy(c)
+		if err := n.OnDestroy(c); err != nil {
+			errs = append(errs, newNodeError(c, n, PhaseDestroy, err))
+		}
 	}
 
+	DisableProfiling(c)
+	reportLeaks(c)
+
 	if c.Config != nil {
 		c.Config = nil
 	}
@@ -200,41 +401,58 @@ func Reset(c *State) {
 		c.surface.Release()
 		c.surface = nil
 	}
+
+	return errs.err()
 }
 
-func SetViewportDimensions(c *State, width int, height int) {
-	fmt.Println("set viewport dims!", width, height)
+func SetViewportDimensions(c *State, width int, height int) error {
+	logger(c).Debug("set viewport dimensions", "width", width, "height", height)
 
 	if width > 0 && height > 0 {
-		// Get the actual framebuffer size (physical pixels) for the swap chain.
+		// the swap chain uses the actual framebuffer size (physical pixels).
 		// On high-DPI displays, this is larger than the logical window size.
-		fbWidth, fbHeight := c.window.GetFramebufferSize()
-
-		c.Config.Width = uint32(fbWidth)
-		c.Config.Height = uint32(fbHeight)
-
-		fmt.Println("surface resized to physical pixels:", fbWidth, fbHeight)
-		c.surface.Configure(c.adapter, c.Device, c.Config)
+		configureSurface(c)
+		logger(c).Debug("surface resized to physical pixels", "width", c.Config.Width, "height", c.Config.Height)
 
 		// Store the game viewport dimensions (used for rendering calculations)
 		c.Viewport.width = width
 		c.Viewport.height = height
-		for _, n := range c.Nodes {
-			n.OnResize(c)
-		}
+		return notifyNodes(c, PhaseResize)
 	}
+
+	return nil
 }
 
-func SetViewportPosition(c *State, pos [2]int) {
-	fmt.Println("set viewport pos!", pos[0], pos[1], "zoom:", c.Viewport.Zoom)
+// center the view on pos, in world pixels
+func SetViewportPosition(c *State, pos [2]float32) error {
+	logger(c).Debug("set viewport position", "x", pos[0], "y", pos[1], "zoom", c.Viewport.Zoom)
 
-	c.Viewport.position[0] = pos[0] - (c.Viewport.width / 2 / c.Viewport.Zoom)
-	c.Viewport.position[1] = pos[1] - (c.Viewport.height / 2 / c.Viewport.Zoom)
-	for _, n := range c.Nodes {
-		n.OnViewportPosition(c)
-	}
+	c.Viewport.center = pos
+	return notifyNodes(c, PhaseViewport)
+}
+
+// zoom around the center of the view. setting Viewport.Zoom directly only takes effect on the next
+// SetViewportPosition or SetViewportDimensions
+func SetViewportZoom(c *State, zoom float32) error {
+	logger(c).Debug("set viewport zoom", "zoom", zoom)
+
+	c.Viewport.Zoom = zoom
+	return notifyNodes(c, PhaseViewport)
 }
 
-func InitNode(c *State, opts *NodeOptions) (*NodeInstance, error) {
-	return nil, nil
+// call OnResize or OnViewportPosition on every node, collecting the failures
+func notifyNodes(c *State, phase string) error {
+	var errs NodeErrors
+	for _, n := range c.Nodes {
+		var err error
+		if phase == PhaseResize {
+			err = n.OnResize(c)
+		} else {
+			err = n.OnViewportPosition(c)
+		}
+		if err != nil {
+			errs = append(errs, newNodeError(c, n, phase, err))
+		}
+	}
+	return errs.err()
 }
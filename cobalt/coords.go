@@ -0,0 +1,219 @@
+package cobalt
+
+import "math"
+
+/*
+Conversions between the coordinate spaces a game deals with:
+
+	screen    window coordinates, as reported by glfw (Window.GetCursorPos). on HiDPI displays one screen unit
+	          covers several framebuffer pixels
+	viewport  pixels of the game image, i.e. the space IsScreenSpace sprites are drawn in. 0,0 is the top left
+	          of the view and the size is the viewport dimensions divided by the zoom
+	world     the space sprites, tile queries and Camera positions use
+
+They follow the same steps as rendering: the surface is scaled to the window, the upscale node's letterboxing is
+removed, the view under the point is picked (see AddView), and the snapped viewport position and zoom are applied
+exactly as writeSpriteBuffer does. Parallax tile layers have their own ScreenToLayer.
+*/
+
+// world position under a screen point. ok is false over letterbox bars and areas no view covers
+func ScreenToWorld(c *State, screen [2]float32) ([2]float32, bool) {
+	vp, uv, ok := viewportAt(c, screen)
+	if !ok {
+		return [2]float32{}, false
+	}
+	return uvToWorld(vp, uv), true
+}
+
+// screen point a world position is drawn at. with views, the first view is used (see View.WorldToScreen)
+func WorldToScreen(c *State, world [2]float32) [2]float32 {
+	if len(c.views) > 0 {
+		return c.views[0].WorldToScreen(c, world)
+	}
+	return uvToScreen(c, nil, worldToUV(c.Viewport, world))
+}
+
+// where a world position appears in viewport pixels, for placing IsScreenSpace sprites (hud markers) over it
+func WorldToViewport(c *State, world [2]float32) [2]float32 {
+	vp := c.Viewport
+	if len(c.views) > 0 {
+		vp = c.views[0].viewport(c.Viewport)
+	}
+	pos := vp.position()
+	return [2]float32{world[0] - pos[0], world[1] - pos[1]}
+}
+
+// like ScreenToWorld, but only hits inside this view
+func (v *View) ScreenToWorld(c *State, screen [2]float32) ([2]float32, bool) {
+	uv, ok := screenToOutput(c, screen)
+	if !ok {
+		return [2]float32{}, false
+	}
+
+	uv, ok = outputToView(v, uv)
+	if !ok {
+		return [2]float32{}, false
+	}
+	return uvToWorld(v.viewport(c.Viewport), uv), true
+}
+
+func (v *View) WorldToScreen(c *State, world [2]float32) [2]float32 {
+	return uvToScreen(c, v, worldToUV(v.viewport(c.Viewport), world))
+}
+
+// ScreenToWorld through the view the camera drives, or the main viewport
+func (cam *Camera) ScreenToWorld(c *State, screen [2]float32) ([2]float32, bool) {
+	if cam.view != nil {
+		return cam.view.ScreenToWorld(c, screen)
+	}
+	return ScreenToWorld(c, screen)
+}
+
+func (cam *Camera) WorldToScreen(c *State, world [2]float32) [2]float32 {
+	if cam.view != nil {
+		return cam.view.WorldToScreen(c, world)
+	}
+	return uvToScreen(c, nil, worldToUV(c.Viewport, world))
+}
+
+// the position to pass to this layer's tile queries (TileAt etc.) to get the tile drawn under a screen point.
+// differs from ScreenToWorld when the layer scrolls at a parallax ScrollScale or drifts with ScrollVelocity
+func (t *TileLayerNode) ScreenToLayer(c *State, screen [2]float32) ([2]float32, bool) {
+	return screenToLayer(c, screen, t.TileAtlas, t.ScrollScale, t.scrollOffset())
+}
+
+func (t *ChunkedTileLayerNode) ScreenToLayer(c *State, screen [2]float32) ([2]float32, bool) {
+	return screenToLayer(c, screen, t.TileAtlas, t.ScrollScale, t.ScrollOffset)
+}
+
+// offset is the layer's scroll offset, added by the shader and by worldToCell alike
+func screenToLayer(c *State, screen [2]float32, atlas *TileAtlasNode, scrollScale, offset [2]float32) ([2]float32, bool) {
+	vp, uv, ok := viewportAt(c, screen)
+	if !ok {
+		return [2]float32{}, false
+	}
+
+	// PixelCoord in node-tile.wgsl, then back through worldToLayerPixel
+	game := vp.worldSize()
+	pos := vp.position()
+	scale := float32(atlas.TileScale)
+
+	var pixel [2]float32
+	for i := 0; i < 2; i++ {
+		pixel[i] = float32(uv[i])*game[i]/scale + pos[i]*scrollScale[i] + offset[i]
+	}
+	return layerPixelToWorld(atlas, offset, pixel), true
+}
+
+// the viewport drawn under a screen point, and the point's position within it as fractions (0..1)
+func viewportAt(c *State, screen [2]float32) (Viewport, [2]float64, bool) {
+	uv, ok := screenToOutput(c, screen)
+	if !ok {
+		return Viewport{}, uv, false
+	}
+
+	if len(c.views) == 0 {
+		return c.Viewport, uv, true
+	}
+
+	for _, v := range c.views {
+		if vuv, ok := outputToView(v, uv); ok {
+			return v.viewport(c.Viewport), vuv, true
+		}
+	}
+	return Viewport{}, uv, false
+}
+
+// screen point -> fraction of the game image. ok is false outside of it
+func screenToOutput(c *State, screen [2]float32) ([2]float64, bool) {
+	scale, ok := surfaceScale(c)
+	if !ok {
+		return [2]float64{}, false
+	}
+	return surfaceToOutput(c, [2]float64{float64(screen[0]) * scale[0], float64(screen[1]) * scale[1]})
+}
+
+// surface pixel -> fraction of the game image. ok is false outside of it
+func surfaceToOutput(c *State, surface [2]float64) ([2]float64, bool) {
+	x, y, w, h := outputRect(c)
+	uv := [2]float64{
+		(surface[0] - x) / w,
+		(surface[1] - y) / h,
+	}
+	return uv, uv[0] >= 0 && uv[0] < 1 && uv[1] >= 0 && uv[1] < 1
+}
+
+// fraction of a viewport -> screen point. v is the view the viewport belongs to, nil for the main one
+func uvToScreen(c *State, v *View, uv [2]float64) [2]float32 {
+	if v != nil {
+		r := v.rect()
+		uv[0] = float64(r[0]) + uv[0]*float64(r[2])
+		uv[1] = float64(r[1]) + uv[1]*float64(r[3])
+	}
+
+	scale, ok := surfaceScale(c)
+	if !ok {
+		return [2]float32{}
+	}
+
+	x, y, w, h := outputRect(c)
+	return [2]float32{
+		float32((x + uv[0]*w) / scale[0]),
+		float32((y + uv[1]*h) / scale[1]),
+	}
+}
+
+// fraction of the game image -> fraction of a view
+func outputToView(v *View, uv [2]float64) ([2]float64, bool) {
+	r := v.rect()
+	out := [2]float64{
+		(uv[0] - float64(r[0])) / float64(r[2]),
+		(uv[1] - float64(r[1])) / float64(r[3]),
+	}
+	return out, out[0] >= 0 && out[0] < 1 && out[1] >= 0 && out[1] < 1
+}
+
+func uvToWorld(vp Viewport, uv [2]float64) [2]float32 {
+	pos := vp.position()
+	size := vp.worldSize()
+	return [2]float32{
+		pos[0] + float32(uv[0])*size[0],
+		pos[1] + float32(uv[1])*size[1],
+	}
+}
+
+func worldToUV(vp Viewport, world [2]float32) [2]float64 {
+	pos := vp.position()
+	size := vp.worldSize()
+	return [2]float64{
+		float64((world[0] - pos[0]) / size[0]),
+		float64((world[1] - pos[1]) / size[1]),
+	}
+}
+
+// surface pixels per screen unit. more than 1 on HiDPI displays
+func surfaceScale(c *State) ([2]float64, bool) {
+	if c.window == nil || c.Config == nil {
+		return [2]float64{}, false
+	}
+
+	w, h := c.window.GetSize()
+	if w <= 0 || h <= 0 {
+		return [2]float64{}, false
+	}
+	return [2]float64{float64(c.Config.Width) / float64(w), float64(c.Config.Height) / float64(h)}, true
+}
+
+// where the game image is on the surface, in surface pixels: the upscale node's letterboxed rect, or the
+// whole surface when there's no upscale node
+func outputRect(c *State) (x, y, w, h float64) {
+	for _, n := range c.Nodes {
+		u, ok := n.(*UpscaleNode)
+		if !ok || !u.IsEnabled() || u.SourceFb == nil || u.SourceFb.Material == nil {
+			continue
+		}
+		r := u.Rect(c)
+		return float64(r.Min.X), float64(r.Min.Y), math.Max(float64(r.Dx()), 1), math.Max(float64(r.Dy()), 1)
+	}
+	return 0, 0, math.Max(float64(c.Config.Width), 1), math.Max(float64(c.Config.Height), 1)
+}
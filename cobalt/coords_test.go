@@ -0,0 +1,319 @@
+package cobalt
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+func near(a, b, eps float64) bool {
+	return math.Abs(a-b) <= eps
+}
+
+func nearVec(a, b [2]float32, eps float64) bool {
+	return near(float64(a[0]), float64(b[0]), eps) && near(float64(a[1]), float64(b[1]), eps)
+}
+
+func TestViewportPositionAndWorldSize(t *testing.T) {
+	tests := []struct {
+		name string
+		vp   Viewport
+		pos  [2]float32
+		size [2]float32
+	}{
+		{
+			name: "zoom 1 centered on the level",
+			vp:   Viewport{width: 480, height: 270, Zoom: 1, center: [2]float32{240, 135}},
+			pos:  [2]float32{0, 0},
+			size: [2]float32{480, 270},
+		},
+		{
+			name: "zoom 0 is treated as 1",
+			vp:   Viewport{width: 480, height: 270, Snap: SnapNone, center: [2]float32{10.5, 0}},
+			pos:  [2]float32{-229.5, -135},
+			size: [2]float32{480, 270},
+		},
+		{
+			name: "zoom 2 without snapping",
+			vp:   Viewport{width: 480, height: 270, Zoom: 2, Snap: SnapNone, center: [2]float32{100.3, 50.6}},
+			pos:  [2]float32{-19.7, -16.9},
+			size: [2]float32{240, 135},
+		},
+		{
+			name: "zoom 2 snapped to world pixels",
+			vp:   Viewport{width: 480, height: 270, Zoom: 2, Snap: SnapWorldPixel, center: [2]float32{100.3, 50.6}},
+			pos:  [2]float32{-20, -17},
+			size: [2]float32{240, 135},
+		},
+		{
+			name: "zoom 2 snapped to screen pixels",
+			vp:   Viewport{width: 480, height: 270, Zoom: 2, Snap: SnapScreenPixel, center: [2]float32{100.3, 50.6}},
+			pos:  [2]float32{-19.5, -17},
+			size: [2]float32{240, 135},
+		},
+		{
+			name: "fractional zoom",
+			vp:   Viewport{width: 480, height: 270, Zoom: 1.5, Snap: SnapNone, center: [2]float32{0, 0}},
+			pos:  [2]float32{-160, -90},
+			size: [2]float32{320, 180},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.vp.worldSize(); !nearVec(got, tt.size, 1e-4) {
+				t.Errorf("worldSize() = %v, want %v", got, tt.size)
+			}
+			if got := tt.vp.position(); !nearVec(got, tt.pos, 1e-4) {
+				t.Errorf("position() = %v, want %v", got, tt.pos)
+			}
+		})
+	}
+}
+
+func TestUVWorldRoundTrip(t *testing.T) {
+	snaps := []struct {
+		name string
+		snap PixelSnap
+	}{
+		{"world pixel", SnapWorldPixel},
+		{"screen pixel", SnapScreenPixel},
+		{"none", SnapNone},
+	}
+	uvs := [][2]float64{{0, 0}, {0.5, 0.5}, {0.25, 0.9}, {1, 1}}
+
+	for _, zoom := range []float32{0.5, 1, 1.5, 2, 3} {
+		for _, s := range snaps {
+			vp := Viewport{width: 480, height: 270, Zoom: zoom, Snap: s.snap, center: [2]float32{123.4, -56.7}}
+
+			for _, uv := range uvs {
+				world := uvToWorld(vp, uv)
+				back := worldToUV(vp, world)
+				if !near(back[0], uv[0], 1e-5) || !near(back[1], uv[1], 1e-5) {
+					t.Errorf("zoom %v snap %s: worldToUV(uvToWorld(%v)) = %v", zoom, s.name, uv, back)
+				}
+			}
+
+			// the top left corner is the snapped position, and the middle stays within a snap step of the center
+			if got, want := uvToWorld(vp, [2]float64{0, 0}), vp.position(); got != want {
+				t.Errorf("zoom %v snap %s: uvToWorld(0, 0) = %v, want %v", zoom, s.name, got, want)
+			}
+
+			step := 1e-3
+			switch s.snap {
+			case SnapWorldPixel:
+				step = 0.5
+			case SnapScreenPixel:
+				step = 0.5 / float64(zoom)
+			}
+			if mid := uvToWorld(vp, [2]float64{0.5, 0.5}); !nearVec(mid, vp.center, step+1e-4) {
+				t.Errorf("zoom %v snap %s: uvToWorld(0.5, 0.5) = %v, more than %v from %v", zoom, s.name, mid, step, vp.center)
+			}
+		}
+	}
+}
+
+func TestOutputToViewSplitScreen(t *testing.T) {
+	left := &View{Name: "left", Rect: [4]float32{0, 0, 0.5, 1}}
+	right := &View{Name: "right", Rect: [4]float32{0.5, 0, 0.5, 1}}
+	minimap := &View{Name: "minimap", Rect: [4]float32{0.75, 0, 0.25, 0.25}}
+	whole := &View{Name: "whole"}
+
+	tests := []struct {
+		name string
+		view *View
+		uv   [2]float64
+		want [2]float64
+		ok   bool
+	}{
+		{"left half, inside", left, [2]float64{0.25, 0.5}, [2]float64{0.5, 0.5}, true},
+		{"left half, point in the right half", left, [2]float64{0.75, 0.5}, [2]float64{1.5, 0.5}, false},
+		{"right half, inside", right, [2]float64{0.75, 0.5}, [2]float64{0.5, 0.5}, true},
+		{"right half, point in the left half", right, [2]float64{0.25, 0.5}, [2]float64{-0.5, 0.5}, false},
+		{"the split belongs to the right half", right, [2]float64{0.5, 0.5}, [2]float64{0, 0.5}, true},
+		{"the split is outside the left half", left, [2]float64{0.5, 0.5}, [2]float64{1, 0.5}, false},
+		{"minimap corner", minimap, [2]float64{0.8, 0.1}, [2]float64{0.2, 0.4}, true},
+		{"below the minimap", minimap, [2]float64{0.8, 0.5}, [2]float64{0.2, 2}, false},
+		{"zero rect covers the target", whole, [2]float64{0.3, 0.7}, [2]float64{0.3, 0.7}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := outputToView(tt.view, tt.uv)
+			if ok != tt.ok || !near(got[0], tt.want[0], 1e-6) || !near(got[1], tt.want[1], 1e-6) {
+				t.Errorf("outputToView(%v) = %v, %v, want %v, %v", tt.uv, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestViewViewport(t *testing.T) {
+	base := Viewport{width: 480, height: 270, Zoom: 1, center: [2]float32{240, 135}}
+
+	tests := []struct {
+		name string
+		view *View
+		size [2]float32 // world size
+	}{
+		{"left half", &View{Rect: [4]float32{0, 0, 0.5, 1}}, [2]float32{240, 270}},
+		{"left half zoomed", &View{Rect: [4]float32{0, 0, 0.5, 1}, Zoom: 2}, [2]float32{120, 135}},
+		{"quarter", &View{Rect: [4]float32{0.75, 0, 0.25, 0.25}}, [2]float32{120, 68}},
+		{"zero rect", &View{}, [2]float32{480, 270}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vp := tt.view.viewport(base)
+			if got := vp.worldSize(); !nearVec(got, tt.size, 1e-4) {
+				t.Errorf("worldSize() = %v, want %v", got, tt.size)
+			}
+			if vp.center != base.center {
+				t.Errorf("center = %v, want the base viewport's %v", vp.center, base.center)
+			}
+		})
+	}
+}
+
+func TestOutputToViewThroughUpscale(t *testing.T) {
+	left := &View{Name: "left", Rect: [4]float32{0, 0, 0.5, 1}}
+	right := &View{Name: "right", Rect: [4]float32{0.5, 0, 0.5, 1}}
+
+	type point struct {
+		surface [2]float64
+		view    *View // nil when the point is over a bar
+		uv      [2]float64
+	}
+
+	tests := []struct {
+		name    string
+		mode    UpscaleMode
+		surface [2]int
+		rect    image.Rectangle
+		points  []point
+	}{
+		{
+			name:    "integer, letterboxed and pillarboxed",
+			mode:    UpscaleInteger,
+			surface: [2]int{1000, 600},
+			rect:    image.Rect(20, 30, 980, 570),
+			points: []point{
+				{surface: [2]float64{20, 30}, view: left, uv: [2]float64{0, 0}},
+				{surface: [2]float64{260, 300}, view: left, uv: [2]float64{0.5, 0.5}},
+				{surface: [2]float64{500, 300}, view: right, uv: [2]float64{0, 0.5}},
+				{surface: [2]float64{740, 435}, view: right, uv: [2]float64{0.5, 0.75}},
+				{surface: [2]float64{10, 300}},  // left bar
+				{surface: [2]float64{500, 20}},  // top bar
+				{surface: [2]float64{980, 300}}, // right edge is outside
+			},
+		},
+		{
+			name:    "integer, window smaller than the game",
+			mode:    UpscaleInteger,
+			surface: [2]int{240, 200},
+			rect:    image.Rect(0, 32, 240, 167),
+			points: []point{
+				{surface: [2]float64{60, 99.5}, view: left, uv: [2]float64{0.5, 0.5}},
+				{surface: [2]float64{120, 32}, view: right, uv: [2]float64{0, 0}},
+				{surface: [2]float64{120, 20}},
+			},
+		},
+		{
+			name:    "sharp bilinear fills the width",
+			mode:    UpscaleSharpBilinear,
+			surface: [2]int{1000, 600},
+			rect:    image.Rect(0, 18, 1000, 581),
+			points: []point{
+				{surface: [2]float64{0, 18}, view: left, uv: [2]float64{0, 0}},
+				{surface: [2]float64{750, 299.5}, view: right, uv: [2]float64{0.5, 0.5}},
+				{surface: [2]float64{500, 10}},
+				{surface: [2]float64{500, 590}},
+			},
+		},
+		{
+			name:    "sharp bilinear, exact fit",
+			mode:    UpscaleSharpBilinear,
+			surface: [2]int{960, 540},
+			rect:    image.Rect(0, 0, 960, 540),
+			points: []point{
+				{surface: [2]float64{240, 270}, view: left, uv: [2]float64{0.5, 0.5}},
+				{surface: [2]float64{959, 539}, view: right, uv: [2]float64{479.0 / 480, 539.0 / 540}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UpscaleNode{
+				Mode:     tt.mode,
+				SourceFb: &FrameBufferNode{Material: &Texture{Size: TextureDimensions{Width: 480, Height: 270}}},
+			}
+			c := &State{
+				Config: &wgpu.SurfaceConfiguration{Width: uint32(tt.surface[0]), Height: uint32(tt.surface[1])},
+				Nodes:  []NodeDefinition{u},
+				views:  []*View{left, right},
+			}
+
+			if got := u.Rect(c); got != tt.rect {
+				t.Fatalf("Rect() = %v, want %v", got, tt.rect)
+			}
+
+			for _, p := range tt.points {
+				out, ok := surfaceToOutput(c, p.surface)
+				if p.view == nil {
+					if ok {
+						t.Errorf("surface point %v: got output %v, want a bar", p.surface, out)
+					}
+					continue
+				}
+				if !ok {
+					t.Errorf("surface point %v: fell outside the game image (%v)", p.surface, out)
+					continue
+				}
+
+				var hit *View
+				var uv [2]float64
+				for _, v := range c.views {
+					if vuv, ok := outputToView(v, out); ok {
+						hit, uv = v, vuv
+						break
+					}
+				}
+				if hit != p.view {
+					t.Errorf("surface point %v: hit view %v, want %q", p.surface, hit, p.view.Name)
+					continue
+				}
+				if !near(uv[0], p.uv[0], 1e-6) || !near(uv[1], p.uv[1], 1e-6) {
+					t.Errorf("surface point %v: view uv %v, want %v", p.surface, uv, p.uv)
+				}
+			}
+		})
+	}
+}
+
+func TestUpscaleScale(t *testing.T) {
+	src := [2]float64{480, 270}
+
+	tests := []struct {
+		name string
+		mode UpscaleMode
+		dst  [2]float64
+		want float64
+	}{
+		{"integer rounds down", UpscaleInteger, [2]float64{1000, 600}, 2},
+		{"integer exact", UpscaleInteger, [2]float64{1440, 810}, 3},
+		{"integer limited by height", UpscaleInteger, [2]float64{2000, 600}, 2},
+		{"integer shrinks below 1", UpscaleInteger, [2]float64{240, 200}, 0.5},
+		{"sharp bilinear keeps the fraction", UpscaleSharpBilinear, [2]float64{1000, 600}, 1000.0 / 480},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UpscaleNode{Mode: tt.mode}
+			if got := u.scale(src, tt.dst); !near(got, tt.want, 1e-9) {
+				t.Errorf("scale(%v, %v) = %v, want %v", src, tt.dst, got, tt.want)
+			}
+		})
+	}
+}
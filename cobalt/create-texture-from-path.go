@@ -11,6 +11,16 @@ import (
 )
 
 func CreateTextureFromPath(c *State, label string, path string, format wgpu.TextureFormat) (*Texture, error) {
+	rgba, err := loadImageRGBA(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateTextureFromImage(c, label, rgba, format)
+}
+
+// decode a png into *image.RGBA (straight alpha)
+func loadImageRGBA(path string) (*image.RGBA, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -22,10 +32,14 @@ func CreateTextureFromPath(c *State, label string, path string, format wgpu.Text
 		return nil, err
 	}
 
-	// Convert to *image.RGBA (straight alpha)
 	rgba := image.NewRGBA(img.Bounds())
 	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
 
+	return rgba, nil
+}
+
+// upload an in-memory RGBA image into a new texture
+func CreateTextureFromImage(c *State, label string, rgba *image.RGBA, format wgpu.TextureFormat) (*Texture, error) {
 	w := rgba.Bounds().Dx()
 	h := rgba.Bounds().Dy()
 	if w == 0 || h == 0 {
@@ -40,8 +54,20 @@ func CreateTextureFromPath(c *State, label string, path string, format wgpu.Text
 		return nil, err
 	}
 
+	if err := writeTextureRegion(c, t, rgba, rgba.Bounds(), 0, 0); err != nil {
+		t.Release()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// copy the pixels of rect from rgba into the texture, with the top-left corner at (x, y)
+func writeTextureRegion(c *State, t *Texture, rgba *image.RGBA, rect image.Rectangle, x int, y int) error {
+	w := rect.Dx()
+	h := rect.Dy()
 	if w == 0 || h == 0 {
-		return nil, errors.New("empty image")
+		return nil
 	}
 
 	// WebGPU requires bytesPerRow to be a multiple of 256.
@@ -50,24 +76,24 @@ func CreateTextureFromPath(c *State, label string, path string, format wgpu.Text
 	paddedStride := ((rowStride + 255) / 256) * 256
 
 	var upload []byte
-	if rowStride == paddedStride {
+	if rowStride == paddedStride && rowStride == rgba.Stride && rect.Min == rgba.Rect.Min {
 		// Already aligned; can upload directly.
-		upload = rgba.Pix
+		upload = rgba.Pix[:paddedStride*h]
 	} else {
 		// Pad each row out to paddedStride.
 		upload = make([]byte, paddedStride*h)
-		src := rgba.Pix
-		for y := 0; y < h; y++ {
-			copy(upload[y*paddedStride:y*paddedStride+rowStride], src[y*rgba.Stride:y*rgba.Stride+rowStride])
+		for row := 0; row < h; row++ {
+			src := rgba.PixOffset(rect.Min.X, rect.Min.Y+row)
+			copy(upload[row*paddedStride:row*paddedStride+rowStride], rgba.Pix[src:src+rowStride])
 		}
 	}
 
 	// Upload pixels
-	c.Queue.WriteTexture(
+	return c.Queue.WriteTexture(
 		&wgpu.ImageCopyTexture{
 			Texture:  t.Texture,
 			MipLevel: 0,
-			Origin:   wgpu.Origin3D{X: 0, Y: 0, Z: 0},
+			Origin:   wgpu.Origin3D{X: uint32(x), Y: uint32(y), Z: 0},
 			Aspect:   wgpu.TextureAspectAll,
 		},
 		upload,
@@ -82,6 +108,4 @@ func CreateTextureFromPath(c *State, label string, path string, format wgpu.Text
 			DepthOrArrayLayers: 1,
 		},
 	)
-
-	return t, nil
 }
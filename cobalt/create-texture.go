@@ -1,7 +1,6 @@
 package cobalt
 
 import "github.com/cogentcore/webgpu/wgpu"
-import "fmt"
 
 type TextureDimensions struct {
 	Width  int
@@ -14,6 +13,8 @@ type Texture struct {
 	View    *wgpu.TextureView
 	MipView []wgpu.TextureView
 	Sampler *wgpu.Sampler
+
+	tracker *resourceTracker // see Release
 }
 
 type TextureMipView struct {
@@ -32,7 +33,7 @@ type TextureMipView struct {
 func CreateTexture(c *State, label string, width int, height int, mip_count uint32, format wgpu.TextureFormat, usage wgpu.TextureUsage) (*Texture, error) {
 	t := &Texture{}
 
-fmt.Println("mip_count:", mip_count, "tex format:", format)
+	logger(c).Debug("create texture", "label", label, "width", width, "height", height, "mipCount", mip_count, "format", format)
 
 	t.Size.Width = width
 	t.Size.Height = height
@@ -47,6 +48,7 @@ fmt.Println("mip_count:", mip_count, "tex format:", format)
 	}
 	texture, err := c.Device.CreateTexture(&texDesc)
 	if err != nil {
+		t.Release()
 		return nil, err
 	}
 
@@ -54,6 +56,7 @@ fmt.Println("mip_count:", mip_count, "tex format:", format)
 
 	view, err := t.Texture.CreateView(nil)
 	if err != nil {
+		t.Release()
 		return nil, err
 	}
 
@@ -70,6 +73,7 @@ fmt.Println("mip_count:", mip_count, "tex format:", format)
 			ArrayLayerCount: 1, // 0 means "all layers from base"
 		})
 		if err != nil {
+			t.Release()
 			return nil, err
 		}
 		t.MipView = append(t.MipView, *mipV)
@@ -93,8 +97,13 @@ fmt.Println("mip_count:", mip_count, "tex format:", format)
     	Compare:       wgpu.CompareFunctionUndefined,
 	})
 	if err != nil {
+		t.Release()
 		return nil, err
 	}
 	t.Sampler = sampler
+
+	t.tracker = &c.resources
+	c.resources.add(nil, ResourceTexture, t)
+
 	return t, nil
 }
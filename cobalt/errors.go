@@ -0,0 +1,100 @@
+package cobalt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the node callback that failed
+const (
+	PhaseInit     = "init"
+	PhaseRun      = "run"
+	PhaseResize   = "resize"
+	PhaseViewport = "viewport"
+	PhaseDestroy  = "destroy"
+	PhaseReload   = "reload"
+	PhaseFormat   = "surface format"
+)
+
+type NodeError struct {
+	Type  string
+	Name  string // graph name. empty for nodes appended to State.Nodes directly
+	Phase string
+	Err   error
+}
+
+func (e *NodeError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("cobalt: %s node %s: %v", e.Type, e.Phase, e.Err)
+	}
+	return fmt.Sprintf("cobalt: %s node %q %s: %v", e.Type, e.Name, e.Phase, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// every node that failed during one call (a frame, a resize, ...). use errors.As to get at the individual NodeErrors
+type NodeErrors []*NodeError
+
+func (e NodeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ne := range e {
+		msgs[i] = ne.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e NodeErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, ne := range e {
+		errs[i] = ne
+	}
+	return errs
+}
+
+// nil when empty, so a NodeErrors can be returned as an error without a typed nil
+func (e NodeErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// what Draw does when a node's OnRun returns an error
+type ErrorPolicy int
+
+const (
+	ErrorPolicySkip    ErrorPolicy = iota // keep running the remaining nodes and report the error
+	ErrorPolicyDisable                    // stop running the failing node in later frames and report the error
+	ErrorPolicyAbort                      // stop the frame at the failing node; nothing is submitted
+)
+
+// override State.ErrorPolicy for one node
+func SetNodeErrorPolicy(c *State, n NodeDefinition, policy ErrorPolicy) {
+	if c.nodePolicies == nil {
+		c.nodePolicies = make(map[NodeDefinition]ErrorPolicy)
+	}
+	c.nodePolicies[n] = policy
+}
+
+func errorPolicy(c *State, n NodeDefinition) ErrorPolicy {
+	if p, ok := c.nodePolicies[n]; ok {
+		return p
+	}
+	return c.ErrorPolicy
+}
+
+func newNodeError(c *State, n NodeDefinition, phase string, err error) *NodeError {
+	return &NodeError{Type: n.GetType(), Name: nodeName(c, n), Phase: phase, Err: err}
+}
+
+// the graph name of n, or "" if it wasn't declared with InitNode
+func nodeName(c *State, n NodeDefinition) string {
+	for _, inst := range c.graphOrder {
+		if inst.definition == n {
+			return inst.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,397 @@
+package cobalt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+/*
+The render graph lets nodes be declared by name, with named references to the nodes they depend on
+(a tile layer refs a tile atlas, a sprite node refs a spritesheet, etc.), in the style of cobalt's initNode.
+
+A node is initialized as soon as every node it references has been initialized, and is appended to `State.Nodes`
+at that point, so referenced nodes always run before the nodes that use them. Nodes may be declared in any order.
+
+While the game runs, InsertNode, RemoveNode and MoveNode change the render order. Nodes that join a running graph get
+OnResize and OnViewportPosition right after Init, so their uniforms are correct on the first frame they draw.
+*/
+
+// returned by the graph functions when they're called from inside Draw (i.e. from a node's OnRun)
+var ErrGraphBusy = errors.New("cobalt: the render graph can't change while Draw is running")
+
+// nodes that reference other nodes implement NodeRefs so the graph can wire them up before Init
+type NodeRefs interface {
+	SetRef(name string, node NodeDefinition) error
+}
+
+// declare a node in the render graph. the node is initialized immediately if all of its refs are ready,
+// otherwise it waits until they are declared. use ValidateGraph to find nodes that never became ready.
+//
+// the node is either passed in directly (opts.Node) or built by the factory registered for opts.Type.
+func InitNode(c *State, opts *NodeOptions) (*NodeInstance, error) {
+	n, err := declareNode(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resolveGraph(c); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// build the node and add it to the graph, without initializing it
+func declareNode(c *State, opts *NodeOptions) (*NodeInstance, error) {
+	if c.drawing {
+		return nil, ErrGraphBusy
+	}
+	if opts == nil || (opts.Node == nil && opts.Type == "") {
+		return nil, errors.New("cobalt: InitNode requires a Type or a Node")
+	}
+
+	node := opts.Node
+	if node == nil {
+		factory, ok := c.nodeTypes[opts.Type]
+		if !ok {
+			return nil, fmt.Errorf("cobalt: unknown node type %q", opts.Type)
+		}
+
+		var err error
+		node, err = factory(c, opts.Options)
+		if err != nil {
+			return nil, fmt.Errorf("cobalt: node %q: %w", opts.Name, err)
+		}
+	}
+
+	nodeType := node.GetType()
+	if opts.Type != "" && opts.Type != nodeType {
+		return nil, fmt.Errorf("cobalt: node type %q doesn't match its definition (%q)", opts.Type, nodeType)
+	}
+
+	if c.graph == nil {
+		c.graph = make(map[string]*NodeInstance)
+	}
+
+	name := opts.Name
+	for i := len(c.graphOrder); name == ""; i++ {
+		if _, exists := c.graph[nodeType+"#"+strconv.Itoa(i)]; !exists {
+			name = nodeType + "#" + strconv.Itoa(i)
+		}
+	}
+	if _, exists := c.graph[name]; exists {
+		return nil, fmt.Errorf("cobalt: a node named %q already exists", name)
+	}
+
+	refs := make(map[string]string, len(opts.Refs))
+	for k, v := range opts.Refs {
+		refs[k] = v
+	}
+
+	options := make(map[string]any, len(opts.Options))
+	for k, v := range opts.Options {
+		options[k] = v
+	}
+
+	n := &NodeInstance{
+		Name:       name,
+		nodeType:   nodeType,
+		refs:       refs,
+		options:    options,
+		definition: node,
+	}
+
+	if path := findRefCycle(c, n, name, nil); path != nil {
+		return nil, fmt.Errorf("cobalt: node %q has cyclic refs: %v", name, path)
+	}
+
+	c.graph[name] = n
+	c.graphOrder = append(c.graphOrder, n)
+
+	return n, nil
+}
+
+// returns the graph node with the given name, or nil
+func GetNode(c *State, name string) *NodeInstance {
+	return c.graph[name]
+}
+
+// reports every declared node that couldn't be initialized because a ref is missing
+func ValidateGraph(c *State) error {
+	var errs []error
+
+	for _, n := range c.graphOrder {
+		if n.ready {
+			continue
+		}
+		for refName, target := range n.refs {
+			dep := c.graph[target]
+			if dep == nil {
+				errs = append(errs, fmt.Errorf("cobalt: node %q ref %q: no node named %q", n.Name, refName, target))
+			} else if !dep.ready {
+				errs = append(errs, fmt.Errorf("cobalt: node %q ref %q: node %q is not initialized", n.Name, refName, target))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (n *NodeInstance) Node() NodeDefinition {
+	return n.definition
+}
+
+func (n *NodeInstance) Type() string {
+	return n.nodeType
+}
+
+// true once the node's refs are resolved and it has been initialized
+func (n *NodeInstance) Ready() bool {
+	return n.ready
+}
+
+// ref name -> referenced node name
+func (n *NodeInstance) Refs() map[string]string {
+	return n.refs
+}
+
+// depth first walk from n through its refs. returns the path of names if it leads back to start
+func findRefCycle(c *State, n *NodeInstance, start string, path []string) []string {
+	path = append(path, n.Name)
+
+	for _, target := range n.refs {
+		if target == start {
+			return append(path, start)
+		}
+		dep := c.graph[target]
+		if dep == nil || dep.ready {
+			continue
+		}
+		if cycle := findRefCycle(c, dep, start, path); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// initialize every waiting node whose refs are all ready, until nothing changes
+func resolveGraph(c *State) error {
+	for progress := true; progress; {
+		progress = false
+
+		for _, n := range c.graphOrder {
+			if n.ready || !refsReady(c, n) {
+				continue
+			}
+
+			if err := initGraphNode(c, n); err != nil {
+				removeGraphNode(c, n)
+				return &NodeError{Type: n.nodeType, Name: n.Name, Phase: PhaseInit, Err: err}
+			}
+
+			progress = true
+		}
+	}
+
+	return nil
+}
+
+func refsReady(c *State, n *NodeInstance) bool {
+	for _, target := range n.refs {
+		dep := c.graph[target]
+		if dep == nil || !dep.ready {
+			return false
+		}
+	}
+	return true
+}
+
+func initGraphNode(c *State, n *NodeInstance) error {
+	if err := setupNode(c, n); err != nil {
+		return err
+	}
+	return attachNode(c, n.definition, len(c.Nodes))
+}
+
+// wire up the refs and Init
+func setupNode(c *State, n *NodeInstance) error {
+	if len(n.refs) > 0 {
+		r, ok := n.definition.(NodeRefs)
+		if !ok {
+			return fmt.Errorf("node type %q doesn't accept refs", n.nodeType)
+		}
+		for refName, target := range n.refs {
+			if err := r.SetRef(refName, c.graph[target].definition); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Init may have created some of the node's resources before failing. attachNode cleans up the same way
+	if err := n.definition.Init(c); err != nil {
+		n.definition.OnDestroy(c)
+		return err
+	}
+
+	n.ready = true
+	return nil
+}
+
+// put an initialized node into c.Nodes at index and bring it up to date with the current viewport,
+// so it has correct uniforms before its first OnRun
+func attachNode(c *State, node NodeDefinition, index int) error {
+	c.Nodes = slices.Insert(c.Nodes, index, node)
+
+	if c.Viewport.width == 0 || c.Viewport.height == 0 {
+		return nil
+	}
+
+	err := node.OnResize(c)
+	if err == nil {
+		err = node.OnViewportPosition(c)
+	}
+	if err != nil {
+		c.Nodes = slices.Delete(c.Nodes, index, index+1)
+		node.OnDestroy(c)
+		return err
+	}
+	return nil
+}
+
+func removeGraphNode(c *State, n *NodeInstance) {
+	delete(c.graph, n.Name)
+	delete(c.nodePolicies, n.definition)
+	delete(c.failed, n.definition)
+	for i, o := range c.graphOrder {
+		if o == n {
+			c.graphOrder = append(c.graphOrder[:i], c.graphOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// declare a node and initialize it right away at index in the render order (0 renders first), e.g. to add an
+// overlay between two existing layers while the game runs. every node it refs must already be initialized and
+// render before index.
+func InsertNode(c *State, index int, opts *NodeOptions) (*NodeInstance, error) {
+	if index < 0 || index > len(c.Nodes) {
+		return nil, fmt.Errorf("cobalt: insert index %d out of range [0, %d]", index, len(c.Nodes))
+	}
+
+	n, err := declareNode(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(err error) (*NodeInstance, error) {
+		removeGraphNode(c, n)
+		return nil, &NodeError{Type: n.nodeType, Name: n.Name, Phase: PhaseInit, Err: err}
+	}
+
+	for refName, target := range n.refs {
+		dep := c.graph[target]
+		if dep == nil || !dep.ready {
+			return fail(fmt.Errorf("ref %q: node %q is not initialized", refName, target))
+		}
+		if i := slices.Index(c.Nodes, dep.definition); i >= index {
+			return fail(fmt.Errorf("ref %q: node %q must render before index %d", refName, target, index))
+		}
+	}
+
+	if err := setupNode(c, n); err != nil {
+		return fail(err)
+	}
+	if err := attachNode(c, n.definition, index); err != nil {
+		return fail(err)
+	}
+
+	// nodes that were waiting on this one can initialize now
+	return n, resolveGraph(c)
+}
+
+// destroy a node and take it out of the graph. fails if another node still refs it
+func RemoveNode(c *State, name string) error {
+	if c.drawing {
+		return ErrGraphBusy
+	}
+
+	n := c.graph[name]
+	if n == nil {
+		return fmt.Errorf("cobalt: no node named %q", name)
+	}
+
+	for _, o := range c.graphOrder {
+		for refName, target := range o.refs {
+			if target == name && o != n {
+				return fmt.Errorf("cobalt: node %q is still referenced by node %q (ref %q)", name, o.Name, refName)
+			}
+		}
+	}
+
+	removeGraphNode(c, n)
+
+	// a node added later under the same name doesn't inherit this one's views
+	for _, v := range c.views {
+		if slices.Contains(v.Nodes, name) {
+			v.Nodes = slices.DeleteFunc(slices.Clone(v.Nodes), func(s string) bool { return s == name })
+		}
+	}
+
+	if !n.ready {
+		return nil
+	}
+
+	if i := slices.Index(c.Nodes, n.definition); i >= 0 {
+		c.Nodes = slices.Delete(c.Nodes, i, i+1)
+	}
+	if err := n.definition.OnDestroy(c); err != nil {
+		return &NodeError{Type: n.nodeType, Name: n.Name, Phase: PhaseDestroy, Err: err}
+	}
+	return nil
+}
+
+// change where a node renders. it must stay after the nodes it refs and before the nodes that ref it
+func MoveNode(c *State, name string, index int) error {
+	if c.drawing {
+		return ErrGraphBusy
+	}
+
+	n := c.graph[name]
+	if n == nil || !n.ready {
+		return fmt.Errorf("cobalt: no initialized node named %q", name)
+	}
+	if index < 0 || index >= len(c.Nodes) {
+		return fmt.Errorf("cobalt: move index %d out of range [0, %d)", index, len(c.Nodes))
+	}
+
+	from := slices.Index(c.Nodes, n.definition)
+	nodes := slices.Delete(slices.Clone(c.Nodes), from, from+1)
+	nodes = slices.Insert(nodes, index, n.definition)
+
+	for _, o := range c.graphOrder {
+		if !o.ready {
+			continue
+		}
+		at := slices.Index(nodes, o.definition)
+		for refName, target := range o.refs {
+			if slices.Index(nodes, c.graph[target].definition) > at {
+				return fmt.Errorf("cobalt: moving node %q would render node %q before its ref %q (%q)", name, o.Name, refName, target)
+			}
+		}
+	}
+
+	c.Nodes = nodes
+	return nil
+}
+
+// shared by the built-in nodes' SetRef implementations
+func refTypeError(node NodeDefinition, name string, ref NodeDefinition) error {
+	return fmt.Errorf("%s ref %q can't be a %s", node.GetType(), name, ref.GetType())
+}
+
+func unknownRefError(node NodeDefinition, name string) error {
+	return fmt.Errorf("%s has no ref named %q", node.GetType(), name)
+}
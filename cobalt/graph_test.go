@@ -0,0 +1,33 @@
+package cobalt
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRemoveNodeLeavesViews(t *testing.T) {
+	tiles, sprites := &NodeInstance{Name: "tiles"}, &NodeInstance{Name: "sprites"}
+	shared := []string{"tiles", "sprites"}
+
+	c := &State{
+		graph:      map[string]*NodeInstance{"tiles": tiles, "sprites": sprites},
+		graphOrder: []*NodeInstance{tiles, sprites},
+		views: []*View{
+			{Name: "left", Nodes: shared},
+			{Name: "right", Nodes: []string{"sprites", "tiles", "tiles"}},
+		},
+	}
+
+	if err := RemoveNode(c, "tiles"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range c.views {
+		if !slices.Equal(v.Nodes, []string{"sprites"}) {
+			t.Errorf("view %q nodes = %v, want only sprites", v.Name, v.Nodes)
+		}
+	}
+	if !slices.Equal(shared, []string{"tiles", "sprites"}) {
+		t.Errorf("the caller's slice was changed to %v", shared)
+	}
+}
@@ -0,0 +1,142 @@
+package cobalt
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Dev mode hot reloading. When enabled, Draw polls the modification times of every file the nodes were built from
+(textures, spritesheet json, tile properties, shader overrides) and rebuilds the affected GPU resources between
+frames. A file that fails to load or a shader that fails to compile is reported and the node keeps its previous
+resources, so a typo in a shader doesn't take the game down.
+
+Enable it before declaring nodes so shader overrides in ShaderDir are used from the first frame.
+*/
+
+type HotReloadOptions struct {
+	// directory checked for overrides of the built-in shaders (node-sprite.wgsl, node-tile.wgsl, node-blit.wgsl,
+	// node-upscale.wgsl, node-profiler-overlay.wgsl).
+	// usually the cobalt source directory, so edits to the shaders in the repo show up immediately
+	ShaderDir string
+
+	// how often files are checked. defaults to 250ms
+	Interval time.Duration
+}
+
+// nodes implement Reloader to be rebuilt when their files change on disk. nodes run in render order, so a
+// node that refs a reloaded node can watch the same files and rebuild whatever it derived from it. a node that
+// has to release resources its dependents still use rebuilds them itself first (see SpritesheetNode.Reload).
+type Reloader interface {
+	WatchedFiles(c *State) []string
+	Reload(c *State, path string) error
+}
+
+type hotReloader struct {
+	opts     HotReloadOptions
+	modTimes map[watchedFile]time.Time
+	known    map[NodeDefinition]bool // nodes whose files have been recorded at least once
+	lastPoll time.Time
+}
+
+// the same file may be watched by several nodes, so each one tracks it separately
+type watchedFile struct {
+	node NodeDefinition
+	path string
+}
+
+func EnableHotReload(c *State, opts HotReloadOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = 250 * time.Millisecond
+	}
+
+	c.hotReload = &hotReloader{
+		opts:     opts,
+		modTimes: make(map[watchedFile]time.Time),
+		known:    make(map[NodeDefinition]bool),
+		lastPoll: time.Now(),
+	}
+
+	// remember the current state of every file, so nothing reloads on the first poll
+	c.hotReload.scan(c, false)
+}
+
+func DisableHotReload(c *State) {
+	c.hotReload = nil
+}
+
+// called by Draw before the nodes run
+func pollHotReload(c *State) {
+	h := c.hotReload
+	if h == nil || time.Since(h.lastPoll) < h.opts.Interval {
+		return
+	}
+	h.lastPoll = time.Now()
+	h.scan(c, true)
+}
+
+func (h *hotReloader) scan(c *State, reload bool) {
+	for _, n := range c.Nodes {
+		r, ok := n.(Reloader)
+		if !ok {
+			continue
+		}
+
+		// nodes added since the last poll were just built from their files
+		changed := reload && h.known[n]
+		h.known[n] = true
+
+		for _, path := range r.WatchedFiles(c) {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // missing (or being saved), checked again on the next poll
+			}
+
+			key := watchedFile{node: n, path: path}
+			prev, seen := h.modTimes[key]
+			h.modTimes[key] = info.ModTime()
+
+			if !changed || (seen && info.ModTime().Equal(prev)) {
+				continue
+			}
+
+			if err := r.Reload(c, path); err != nil {
+				logger(c).Error("hot reload failed", "path", path, "err", newNodeError(c, n, PhaseReload, err))
+			}
+		}
+	}
+}
+
+// WGSL for a built-in shader: the override in HotReloadOptions.ShaderDir when there is one, else the embedded copy
+func shaderSource(c *State, name string, embedded string) string {
+	path := shaderOverride(c, name)
+	if path == "" {
+		return embedded
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return embedded
+	}
+	return string(raw)
+}
+
+// path of the override file for a built-in shader, or "" when hot reloading has no ShaderDir
+func shaderOverride(c *State, name string) string {
+	if c.hotReload == nil || c.hotReload.opts.ShaderDir == "" {
+		return ""
+	}
+	return filepath.Join(c.hotReload.opts.ShaderDir, name)
+}
+
+// shared by the built-in nodes' WatchedFiles implementations. skips empty paths
+func watchList(paths ...string) []string {
+	var out []string
+	for _, p := range paths {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+//go:build !js
+
+#include <stdint.h>
+#include "wgpu.h"
+#include "_cgo_export.h"
+
+static void cobalt_wgpu_log(WGPULogLevel level, char const *message, void *userdata) {
+	cobaltWgpuLog((uint32_t)level, (char *)message);
+}
+
+void cobalt_forward_wgpu_log(void) {
+	wgpuSetLogCallback(cobalt_wgpu_log, NULL);
+}
@@ -0,0 +1,57 @@
+//go:build !js
+
+package cobalt
+
+// include/ holds wgpu.h and webgpu.h from github.com/cogentcore/webgpu, at the version in go.mod. the binding
+// doesn't export its headers, and log-wgpu.c needs them to set the log callback
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/include
+#include <stdint.h>
+
+extern void cobalt_forward_wgpu_log(void);
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+// wgpu's log callback is process wide, so it logs to the most recently initialized State
+var wgpuLogState atomic.Pointer[State]
+
+// replace the binding's default callback with one that logs to c.Logger, or to stderr like the binding did
+func forwardWgpuLog(c *State) {
+	wgpuLogState.Store(c)
+	C.cobalt_forward_wgpu_log()
+}
+
+//export cobaltWgpuLog
+func cobaltWgpuLog(level C.uint32_t, message *C.char) {
+	c := wgpuLogState.Load()
+	if c == nil || c.Logger == nil {
+		fmt.Fprintf(os.Stderr, "[wgpu] [%s] %s\n", wgpu.LogLevel(level), C.GoString(message))
+		return
+	}
+	c.Logger.Log(context.Background(), wgpuLogLevel(wgpu.LogLevel(level)), C.GoString(message), "source", "wgpu")
+}
+
+func wgpuLogLevel(level wgpu.LogLevel) slog.Level {
+	switch level {
+	case wgpu.LogLevelError:
+		return slog.LevelError
+	case wgpu.LogLevelWarn:
+		return slog.LevelWarn
+	case wgpu.LogLevelInfo:
+		return slog.LevelInfo
+	case wgpu.LogLevelDebug:
+		return slog.LevelDebug
+	}
+	return slog.LevelDebug - 4 // trace
+}
@@ -0,0 +1,4 @@
+package cobalt
+
+// the browser reports wgpu errors in its own console
+func forwardWgpuLog(c *State) {}
@@ -0,0 +1,33 @@
+package cobalt
+
+import (
+	"log/slog"
+	"os"
+)
+
+/*
+Everything cobalt reports goes through `State.Logger`. When it's nil the library is quiet: its own diagnostics are
+discarded, while wgpu's native log output (at the level set by the WGPU_LOG_LEVEL env var) and leaked resource
+reports still go to stderr, so they aren't lost. With a Logger set, both are forwarded into it.
+*/
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// used for the reports that stay visible without a Logger
+var stderrLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// c.Logger, or a logger that discards everything when none is set
+func logger(c *State) *slog.Logger {
+	if c == nil || c.Logger == nil {
+		return discardLogger
+	}
+	return c.Logger
+}
+
+// c.Logger, or stderr when none is set
+func loudLogger(c *State) *slog.Logger {
+	if c == nil || c.Logger == nil {
+		return stderrLogger
+	}
+	return c.Logger
+}
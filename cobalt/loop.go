@@ -0,0 +1,221 @@
+package cobalt
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+/*
+Loop runs the game at a fixed simulation rate, independent of the frame rate:
+
+	loop := &cobalt.Loop{
+		TickRate: 60,
+		Update:   func(c *cobalt.State, dt float32) error { ... }, // dt is always 1/60
+		Render:   func(c *cobalt.State, alpha float32) error { ... },
+	}
+	err := loop.Run(c)
+
+Each frame polls glfw events, runs as many Update steps as the elapsed time calls for, calls Render and then
+Draw. Render gets alpha, how far (0..1) the frame is between the previous step and the next one; blending
+positions from the last two steps by alpha keeps motion smooth when the frame rate and TickRate differ.
+
+Without MaxFPS the frame rate is paced by the present mode: PresentModeFifo (vsync) blocks in Draw until the
+display is ready. Set MaxFPS to cap it when vsync is off (see SetVSync).
+
+Recoverable surface errors skip the frame, and node errors are logged since the ErrorPolicy already handled
+them. Anything else stops the loop.
+*/
+
+type Loop struct {
+	TickRate float64 // simulation steps per second. defaults to 60
+	MaxFPS   float64 // frame cap. 0 leaves pacing to the present mode
+
+	// most Update steps run in one frame. when the simulation falls further behind (a breakpoint, a window
+	// drag, a slow machine) the extra time is dropped instead of catching up. defaults to 8
+	MaxSteps int
+
+	// frames the stats cover. defaults to 240
+	StatsFrames int
+
+	Update func(c *State, dt float32) error    // one simulation step of 1/TickRate seconds
+	Render func(c *State, alpha float32) error // called once per frame, before Draw
+
+	last    time.Time
+	next    time.Time // MaxFPS deadline
+	acc     time.Duration
+	steps   uint64
+	dropped int
+
+	frameTimes []time.Duration // ring buffer, see StatsFrames
+	frameIndex int
+}
+
+type FrameStats struct {
+	Frames  int // frames the stats cover
+	Average time.Duration
+	P99     time.Duration
+	Max     time.Duration
+	Hitches int // frames that took more than twice the average
+
+	Steps   uint64 // Update steps run since the loop started or the last ResetStats
+	Dropped int    // frames where MaxSteps was hit and time was dropped
+}
+
+// run frames until the window is closed
+func (l *Loop) Run(c *State) error {
+	for !c.window.ShouldClose() {
+		if err := l.Frame(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run one frame. for apps that keep their own loop and only want the stepping and pacing
+func (l *Loop) Frame(c *State) error {
+	glfw.PollEvents()
+
+	if err := l.advance(c, time.Now()); err != nil {
+		return err
+	}
+
+	if l.Render != nil {
+		if err := l.Render(c, l.Alpha()); err != nil {
+			return err
+		}
+	}
+
+	err := Draw(c)
+	var nodeErrs NodeErrors
+	switch {
+	case err == nil:
+	case IsRecoverable(err):
+	case errors.As(err, &nodeErrs):
+		logger(c).Error("frame had node errors", "err", err)
+	default:
+		return err
+	}
+
+	l.pace()
+	return nil
+}
+
+// add the time since the previous frame and run the Update steps it calls for
+func (l *Loop) advance(c *State, now time.Time) error {
+	if !l.last.IsZero() {
+		elapsed := now.Sub(l.last)
+		l.record(elapsed)
+		l.acc += elapsed
+	}
+	l.last = now
+
+	step := l.step()
+	for n := 0; l.acc >= step; n++ {
+		if n == l.maxSteps() {
+			l.acc %= step
+			l.dropped++
+			logger(c).Debug("simulation fell behind, dropping time", "steps", n)
+			break
+		}
+		if l.Update != nil {
+			if err := l.Update(c, float32(step.Seconds())); err != nil {
+				return err
+			}
+		}
+		l.acc -= step
+		l.steps++
+	}
+	return nil
+}
+
+// how far the current frame is between the last simulation step and the next one, 0..1
+func (l *Loop) Alpha() float32 {
+	return float32(float64(l.acc) / float64(l.step()))
+}
+
+// frame time statistics over the last StatsFrames frames
+func (l *Loop) Stats() FrameStats {
+	s := FrameStats{Frames: len(l.frameTimes), Steps: l.steps, Dropped: l.dropped}
+	if s.Frames == 0 {
+		return s
+	}
+
+	sorted := slices.Clone(l.frameTimes)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	s.Average = total / time.Duration(s.Frames)
+	s.P99 = sorted[(s.Frames*99-1)/100]
+	s.Max = sorted[s.Frames-1]
+
+	for _, d := range sorted {
+		if d > 2*s.Average {
+			s.Hitches++
+		}
+	}
+	return s
+}
+
+// start the stats over, e.g. after loading a level
+func (l *Loop) ResetStats() {
+	l.frameTimes = l.frameTimes[:0]
+	l.frameIndex = 0
+	l.steps = 0
+	l.dropped = 0
+}
+
+func (l *Loop) record(d time.Duration) {
+	size := l.StatsFrames
+	if size <= 0 {
+		size = 240
+	}
+
+	if len(l.frameTimes) < size {
+		l.frameTimes = append(l.frameTimes, d)
+		return
+	}
+	l.frameTimes[l.frameIndex] = d
+	l.frameIndex = (l.frameIndex + 1) % len(l.frameTimes)
+}
+
+// sleep until the next MaxFPS deadline
+func (l *Loop) pace() {
+	if l.MaxFPS <= 0 {
+		return
+	}
+
+	target := time.Duration(float64(time.Second) / l.MaxFPS)
+	now := time.Now()
+
+	// deadlines advance by a fixed amount so sleep overshoot doesn't accumulate. a frame that ran long
+	// restarts the schedule instead of rushing the following frames
+	if l.next.IsZero() || now.Sub(l.next) > target {
+		l.next = now
+	}
+	l.next = l.next.Add(target)
+
+	if d := l.next.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (l *Loop) step() time.Duration {
+	rate := l.TickRate
+	if rate <= 0 {
+		rate = 60
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+func (l *Loop) maxSteps() int {
+	if l.MaxSteps <= 0 {
+		return 8
+	}
+	return l.MaxSteps
+}
@@ -0,0 +1,202 @@
+package cobalt
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLoopFixedStep(t *testing.T) {
+	type frame struct {
+		elapsed time.Duration
+		steps   int
+		alpha   float32
+	}
+
+	tests := []struct {
+		name    string
+		loop    Loop
+		frames  []frame
+		dt      float32
+		dropped int
+	}{
+		{
+			name: "accumulates partial steps",
+			loop: Loop{TickRate: 50},
+			dt:   0.02,
+			frames: []frame{
+				{elapsed: 10 * time.Millisecond, steps: 0, alpha: 0.5},
+				{elapsed: 15 * time.Millisecond, steps: 1, alpha: 0.25},
+				{elapsed: 40 * time.Millisecond, steps: 2, alpha: 0.25},
+				{elapsed: 15 * time.Millisecond, steps: 1, alpha: 0},
+			},
+		},
+		{
+			name: "drops time past MaxSteps",
+			loop: Loop{TickRate: 50, MaxSteps: 3},
+			dt:   0.02,
+			frames: []frame{
+				{elapsed: 5 * time.Millisecond, steps: 0, alpha: 0.25},
+				{elapsed: 200 * time.Millisecond, steps: 3, alpha: 0.25},
+				{elapsed: 20 * time.Millisecond, steps: 1, alpha: 0.25},
+			},
+			dropped: 1,
+		},
+		{
+			name: "defaults to 60 steps and at most 8 per frame",
+			loop: Loop{},
+			dt:   float32((time.Second / 60).Seconds()),
+			frames: []frame{
+				{elapsed: time.Second / 60, steps: 1, alpha: 0},
+				{elapsed: time.Second, steps: 8, alpha: 0},
+			},
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.loop
+			steps := 0
+			l.Update = func(c *State, dt float32) error {
+				if dt != tt.dt {
+					t.Errorf("Update dt = %v, want %v", dt, tt.dt)
+				}
+				steps++
+				return nil
+			}
+
+			now := time.Unix(1000, 0)
+			if err := l.advance(nil, now); err != nil {
+				t.Fatal(err)
+			}
+			if steps != 0 {
+				t.Fatalf("first frame ran %d steps, want 0", steps)
+			}
+
+			total := 0
+			for i, f := range tt.frames {
+				steps = 0
+				now = now.Add(f.elapsed)
+				if err := l.advance(nil, now); err != nil {
+					t.Fatal(err)
+				}
+				total += f.steps
+
+				if steps != f.steps {
+					t.Errorf("frame %d: %d steps, want %d", i, steps, f.steps)
+				}
+				if a := l.Alpha(); math.Abs(float64(a-f.alpha)) > 1e-4 {
+					t.Errorf("frame %d: Alpha() = %v, want %v", i, a, f.alpha)
+				}
+			}
+
+			s := l.Stats()
+			if s.Steps != uint64(total) || s.Dropped != tt.dropped {
+				t.Errorf("Stats() steps %d dropped %d, want %d and %d", s.Steps, s.Dropped, total, tt.dropped)
+			}
+			if s.Frames != len(tt.frames) {
+				t.Errorf("Stats() covers %d frames, want %d", s.Frames, len(tt.frames))
+			}
+		})
+	}
+}
+
+func TestLoopUpdateError(t *testing.T) {
+	failed := errors.New("update failed")
+	l := Loop{TickRate: 50, Update: func(c *State, dt float32) error { return failed }}
+
+	now := time.Unix(1000, 0)
+	l.advance(nil, now)
+	if err := l.advance(nil, now.Add(30*time.Millisecond)); !errors.Is(err, failed) {
+		t.Fatalf("advance() = %v, want %v", err, failed)
+	}
+	if s := l.Stats(); s.Steps != 0 {
+		t.Errorf("failed step was counted: %d steps", s.Steps)
+	}
+}
+
+func TestLoopStats(t *testing.T) {
+	ms := time.Millisecond
+	repeat := func(d time.Duration, n int) []time.Duration {
+		out := make([]time.Duration, n)
+		for i := range out {
+			out[i] = d
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		size   int // StatsFrames
+		frames []time.Duration
+		want   FrameStats
+	}{
+		{
+			name: "no frames",
+			want: FrameStats{},
+		},
+		{
+			name:   "steady",
+			frames: repeat(10*ms, 50),
+			want:   FrameStats{Frames: 50, Average: 10 * ms, P99: 10 * ms, Max: 10 * ms},
+		},
+		{
+			name:   "one hitch in a hundred stays out of p99",
+			frames: append(repeat(10*ms, 99), 50*ms),
+			want:   FrameStats{Frames: 100, Average: 10400 * time.Microsecond, P99: 10 * ms, Max: 50 * ms, Hitches: 1},
+		},
+		{
+			name:   "with fewer than a hundred frames p99 is the worst",
+			frames: append(repeat(10*ms, 9), 30*ms),
+			want:   FrameStats{Frames: 10, Average: 12 * ms, P99: 30 * ms, Max: 30 * ms, Hitches: 1},
+		},
+		{
+			name:   "frames just under twice the average aren't hitches",
+			frames: []time.Duration{10 * ms, 10 * ms, 10 * ms, 19 * ms},
+			want:   FrameStats{Frames: 4, Average: 12250 * time.Microsecond, P99: 19 * ms, Max: 19 * ms},
+		},
+		{
+			name:   "only the last StatsFrames frames count",
+			size:   4,
+			frames: []time.Duration{100 * ms, 100 * ms, 100 * ms, 10 * ms, 10 * ms, 10 * ms, 10 * ms, 30 * ms},
+			want:   FrameStats{Frames: 4, Average: 15 * ms, P99: 30 * ms, Max: 30 * ms},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Loop{StatsFrames: tt.size}
+			for _, d := range tt.frames {
+				l.record(d)
+			}
+			if got := l.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoopResetStats(t *testing.T) {
+	l := Loop{TickRate: 50, MaxSteps: 1}
+
+	now := time.Unix(1000, 0)
+	l.advance(nil, now)
+	l.advance(nil, now.Add(100*time.Millisecond))
+
+	if s := l.Stats(); s.Steps == 0 || s.Dropped == 0 || s.Frames == 0 {
+		t.Fatalf("Stats() = %+v, want steps, drops and frames before the reset", s)
+	}
+
+	l.ResetStats()
+	if s := l.Stats(); s != (FrameStats{}) {
+		t.Errorf("Stats() after ResetStats = %+v, want zero", s)
+	}
+
+	// the accumulator isn't part of the stats, so stepping carries on where it was
+	l.advance(nil, now.Add(120*time.Millisecond))
+	if s := l.Stats(); s.Steps != 1 || s.Frames != 1 {
+		t.Errorf("Stats() after another frame = %+v, want 1 step over 1 frame", s)
+	}
+}
@@ -1,7 +1,6 @@
 package cobalt
 
 import (
-	"fmt"
 	_ "embed"
 
 	"github.com/cogentcore/webgpu/wgpu"
@@ -18,6 +17,15 @@ type BlitNode struct {
 	BindGroupLayout *wgpu.BindGroupLayout
 	BindGroup *wgpu.BindGroup
 	Pipeline *wgpu.RenderPipeline
+
+	pipelineLayout *wgpu.PipelineLayout
+
+	disabled bool // see SetEnabled
+}
+
+func newBlitNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:blit", options)
+	return &BlitNode{}, r.done()
 }
 
 func (t *BlitNode) Init(c *State) error {
@@ -50,7 +58,7 @@ func (t *BlitNode) Init(c *State) error {
 	t.BindGroupLayout = bindGroupLayout
 
 
-	bindGroup, err := c.Device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+	bindGroup, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
 		Layout: bindGroupLayout,
 		Entries: []wgpu.BindGroupEntry{
 			{
@@ -79,15 +87,22 @@ func (t *BlitNode) Init(c *State) error {
 		return err
 	}
 
+	t.pipelineLayout = pipelineLayout
+
+	return t.buildPipeline(c)
+}
+
+// (re)compile the blit shader and pipeline. on failure the previous pipeline is kept
+func (t *BlitNode) buildPipeline(c *State) error {
 	drawShader, err := c.Device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
 		Label: "node-blit.wgsl",
 		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{
-			Code: blitWGSL,
+			Code: shaderSource(c, "node-blit.wgsl", blitWGSL),
 		},
 	})
 
 	if err != nil {
-		fmt.Println("shader compilation failed:", err)
+		logger(c).Error("shader compilation failed", "shader", "node-blit.wgsl", "err", err)
 		return err
 	}
 
@@ -95,7 +110,7 @@ func (t *BlitNode) Init(c *State) error {
 
 	pipeline, err := c.Device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
 		Label:  "blit",
-		Layout: pipelineLayout,
+		Layout: t.pipelineLayout,
 		Vertex: wgpu.VertexState{
 			Module:     drawShader,
 			EntryPoint: "vs_main",
@@ -138,17 +153,36 @@ func (t *BlitNode) Init(c *State) error {
 		return err
 	}
 
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+	}
 	t.Pipeline = pipeline
 
 	return nil
 }
 
+func (t *BlitNode) WatchedFiles(c *State) []string {
+	return watchList(shaderOverride(c, "node-blit.wgsl"))
+}
+
+func (t *BlitNode) Reload(c *State, path string) error {
+	return t.buildPipeline(c)
+}
+
+func (t *BlitNode) OnSurfaceFormat(c *State) error {
+	return t.buildPipeline(c)
+}
+
 func (t *BlitNode) GetType() string {
 	return "cobalt:blit"
 }
 
 func (t *BlitNode) IsEnabled() bool {
-	return true
+	return !t.disabled
+}
+
+func (t *BlitNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
 }
 
 // view is the backing frame texture view that is created each frame
@@ -180,12 +214,25 @@ func (t *BlitNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Text
 
 	defer renderPass.Release()
 	return renderPass.End()
-
-	return nil
 }
 
 func (t *BlitNode) OnDestroy(c *State) error {
-	
+	releaseBindGroup(c, t.BindGroup)
+	t.BindGroup = nil
+
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+		t.Pipeline = nil
+	}
+	if t.pipelineLayout != nil {
+		t.pipelineLayout.Release()
+		t.pipelineLayout = nil
+	}
+	if t.BindGroupLayout != nil {
+		t.BindGroupLayout.Release()
+		t.BindGroupLayout = nil
+	}
+
 	return nil
 }
 
@@ -195,7 +242,7 @@ func (t *BlitNode) OnViewportPosition(c *State) error {
 
 func (t *BlitNode) OnResize(c *State) error {
 	// re-build the bind group
-	bindGroup, err := c.Device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+	bindGroup, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
 		Layout: t.BindGroupLayout,
 		Entries: []wgpu.BindGroupEntry{
 			{
@@ -213,7 +260,23 @@ func (t *BlitNode) OnResize(c *State) error {
 		return err
 	}
 
+	// the old bind group points at the framebuffer texture that was just replaced
+	releaseBindGroup(c, t.BindGroup)
 	t.BindGroup = bindGroup
 
 	return nil
 }
+
+func (t *BlitNode) SetRef(name string, node NodeDefinition) error {
+	switch name {
+	case "source":
+		fb, ok := node.(*FrameBufferNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.SourceFb = fb
+	default:
+		return unknownRefError(t, name)
+	}
+	return nil
+}
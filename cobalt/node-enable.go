@@ -0,0 +1,49 @@
+package cobalt
+
+import "fmt"
+
+// nodes that can be turned on and off at runtime (e.g. debug layers). every built-in node implements this.
+// disabled nodes are skipped by Draw but still receive OnResize and OnViewportPosition.
+type NodeToggle interface {
+	SetEnabled(c *State, enabled bool) error
+}
+
+// optional hooks run by the built-in nodes' SetEnabled when the state actually changes.
+// OnDisable is the place to release transient GPU resources, which OnEnable rebuilds.
+type NodeEnableHooks interface {
+	OnEnable(*State) error
+	OnDisable(*State) error
+}
+
+func SetNodeEnabled(c *State, n NodeDefinition, enabled bool) error {
+	t, ok := n.(NodeToggle)
+	if !ok {
+		return fmt.Errorf("cobalt: %s node can't be enabled or disabled", n.GetType())
+	}
+	return t.SetEnabled(c, enabled)
+}
+
+func (n *NodeInstance) Enabled() bool {
+	return n.definition.IsEnabled()
+}
+
+func (n *NodeInstance) SetEnabled(c *State, enabled bool) error {
+	return SetNodeEnabled(c, n.definition, enabled)
+}
+
+// shared by the built-in nodes' SetEnabled implementations
+func toggleNode(c *State, n NodeDefinition, disabled *bool, enabled bool) error {
+	if *disabled == !enabled {
+		return nil
+	}
+	*disabled = !enabled
+
+	hooks, ok := n.(NodeEnableHooks)
+	if !ok {
+		return nil
+	}
+	if enabled {
+		return hooks.OnEnable(c)
+	}
+	return hooks.OnDisable(c)
+}
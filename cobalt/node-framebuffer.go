@@ -1,12 +1,11 @@
 package cobalt
 
 import (
-	"fmt"
 
 	"github.com/cogentcore/webgpu/wgpu"
 )
 
-// Frame buffer textures automatically resize to match the cobalt viewport.
+// Frame buffer textures automatically resize to match the cobalt viewport (or the surface, see PhysicalSize).
 
 type FrameBufferNode struct {
 	Label    string
@@ -14,6 +13,34 @@ type FrameBufferNode struct {
 	Usage    wgpu.TextureUsage
 	MipCount uint32
 	Material *Texture // the view this layer renders into
+
+	// size the texture to the surface in physical pixels instead of the viewport dimensions,
+	// for rendering at the display's full resolution
+	PhysicalSize bool
+
+	disabled bool // see SetEnabled
+}
+
+func newFrameBufferNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:framebuffer", options)
+	t := &FrameBufferNode{
+		Label:        r.string("label", "framebuffer"),
+		Format:       r.format("format", c.Config.Format),
+		Usage:        r.usage("usage", wgpu.TextureUsageTextureBinding|wgpu.TextureUsageCopyDst|wgpu.TextureUsageRenderAttachment),
+		MipCount:     uint32(r.int("mipCount", 1)),
+		PhysicalSize: r.bool("physicalSize", false),
+	}
+	return t, r.done()
+}
+
+func (t *FrameBufferNode) Options() map[string]any {
+	return map[string]any{
+		"label":        t.Label,
+		"format":       t.Format.String(),
+		"usage":        usageOption(t.Usage),
+		"mipCount":     t.MipCount,
+		"physicalSize": t.PhysicalSize,
+	}
 }
 
 func (t *FrameBufferNode) Init(c *State) error {
@@ -22,6 +49,7 @@ func (t *FrameBufferNode) Init(c *State) error {
 		return err
 	}
 
+	ownTexture(c, t, tex)
 	t.Material = tex
 
 	return nil
@@ -32,7 +60,11 @@ func (t *FrameBufferNode) GetType() string {
 }
 
 func (t *FrameBufferNode) IsEnabled() bool {
-	return true
+	return !t.disabled
+}
+
+func (t *FrameBufferNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
 }
 
 // view is the backing frame texture view that is created each frame
@@ -42,7 +74,7 @@ func (t *FrameBufferNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wg
 
 func (t *FrameBufferNode) OnDestroy(c *State) error {
 	if t.Material != nil {
-		t.Material.Texture.Release()
+		t.Material.Release()
 		t.Material = nil
 	}
 
@@ -56,13 +88,19 @@ func (t *FrameBufferNode) OnViewportPosition(c *State) error {
 func (t *FrameBufferNode) OnResize(c *State) error {
 	t.OnDestroy(c)
 
-    fmt.Println("Resizing framebuffer node. width:", c.Viewport.width, "height:", c.Viewport.height)
+	width, height := c.Viewport.width, c.Viewport.height
+	if t.PhysicalSize {
+		width, height = int(c.Config.Width), int(c.Config.Height)
+	}
+
+	logger(c).Debug("resize framebuffer", "label", t.Label, "width", width, "height", height)
 
-	tex, err := CreateTexture(c, t.Label, c.Viewport.width,  c.Viewport.height, t.MipCount, t.Format, t.Usage)
+	tex, err := CreateTexture(c, t.Label, width, height, t.MipCount, t.Format, t.Usage)
 	if err != nil {
 		return err
 	}
 
+	ownTexture(c, t, tex)
 	t.Material = tex
 
 	return nil
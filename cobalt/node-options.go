@@ -0,0 +1,282 @@
+package cobalt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+// builds a node of a registered type from its options (see DefineNode)
+type NodeFactory func(c *State, options map[string]any) (NodeDefinition, error)
+
+// reads typed values out of a node's options map. the first bad value is kept in err,
+// and done() also reports any keys that were never read (usually a typo).
+type optionReader struct {
+	nodeType string
+	opts     map[string]any
+	used     map[string]bool
+	err      error
+}
+
+func readOptions(nodeType string, opts map[string]any) *optionReader {
+	return &optionReader{nodeType: nodeType, opts: opts, used: make(map[string]bool)}
+}
+
+func (r *optionReader) get(key string) (any, bool) {
+	r.used[key] = true
+	v, ok := r.opts[key]
+	return v, ok && v != nil
+}
+
+func (r *optionReader) fail(key string, want string, v any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s option %q: expected %s, got %v", r.nodeType, key, want, v)
+	}
+}
+
+func (r *optionReader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	var unknown []string
+	for k := range r.opts {
+		if !r.used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s: unknown options %s", r.nodeType, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (r *optionReader) string(key string, def string) string {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok {
+		r.fail(key, "a string", v)
+		return def
+	}
+	return s
+}
+
+func (r *optionReader) bool(key string, def bool) bool {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	b, ok := v.(bool)
+	if !ok {
+		r.fail(key, "a bool", v)
+		return def
+	}
+	return b
+}
+
+func (r *optionReader) float(key string, def float64) float64 {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		r.fail(key, "a number", v)
+		return def
+	}
+	return f
+}
+
+func (r *optionReader) int(key string, def int) int {
+	f := r.float(key, float64(def))
+	if f != float64(int(f)) {
+		r.fail(key, "an integer", f)
+		return def
+	}
+	return int(f)
+}
+
+// accepts [x, y] or a single number used for both axes
+func (r *optionReader) vec2(key string, def [2]float32) [2]float32 {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	if f, ok := toFloat(v); ok {
+		return [2]float32{float32(f), float32(f)}
+	}
+	f, ok := toFloats(v, 2)
+	if !ok {
+		r.fail(key, "[x, y]", v)
+		return def
+	}
+	return [2]float32{f[0], f[1]}
+}
+
+func (r *optionReader) vec4(key string, def [4]float32) [4]float32 {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	f, ok := toFloats(v, 4)
+	if !ok {
+		r.fail(key, "[r, g, b, a]", v)
+		return def
+	}
+	return [4]float32{f[0], f[1], f[2], f[3]}
+}
+
+func (r *optionReader) color(key string, def wgpu.Color) wgpu.Color {
+	c := r.vec4(key, [4]float32{float32(def.R), float32(def.G), float32(def.B), float32(def.A)})
+	return wgpu.Color{R: float64(c[0]), G: float64(c[1]), B: float64(c[2]), A: float64(c[3])}
+}
+
+// texture formats use their WebGPU names, e.g. "rgba8unorm" or "bgra8unorm-srgb"
+func (r *optionReader) format(key string, def wgpu.TextureFormat) wgpu.TextureFormat {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	if f, ok := v.(wgpu.TextureFormat); ok {
+		return f
+	}
+	s, _ := v.(string)
+	f, ok := parseTextureFormat(s)
+	if !ok {
+		r.fail(key, "a texture format", v)
+		return def
+	}
+	return f
+}
+
+// "load" or "clear"
+func (r *optionReader) loadOp(key string, def wgpu.LoadOp) wgpu.LoadOp {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	if op, ok := v.(wgpu.LoadOp); ok {
+		return op
+	}
+	switch v {
+	case "load":
+		return wgpu.LoadOpLoad
+	case "clear":
+		return wgpu.LoadOpClear
+	}
+	r.fail(key, `"load" or "clear"`, v)
+	return def
+}
+
+// a list of usage names, e.g. ["textureBinding", "renderAttachment"]
+func (r *optionReader) usage(key string, def wgpu.TextureUsage) wgpu.TextureUsage {
+	v, ok := r.get(key)
+	if !ok {
+		return def
+	}
+	if u, ok := v.(wgpu.TextureUsage); ok {
+		return u
+	}
+
+	var names []string
+	switch list := v.(type) {
+	case []string:
+		names = list
+	case []any:
+		for _, n := range list {
+			s, ok := n.(string)
+			if !ok {
+				r.fail(key, "a list of texture usages", v)
+				return def
+			}
+			names = append(names, s)
+		}
+	default:
+		r.fail(key, "a list of texture usages", v)
+		return def
+	}
+
+	var usage wgpu.TextureUsage
+	for _, n := range names {
+		u, ok := textureUsageNames[n]
+		if !ok {
+			r.fail(key, "a list of texture usages", v)
+			return def
+		}
+		usage |= u
+	}
+	return usage
+}
+
+var textureUsageNames = map[string]wgpu.TextureUsage{
+	"copySrc":          wgpu.TextureUsageCopySrc,
+	"copyDst":          wgpu.TextureUsageCopyDst,
+	"textureBinding":   wgpu.TextureUsageTextureBinding,
+	"storageBinding":   wgpu.TextureUsageStorageBinding,
+	"renderAttachment": wgpu.TextureUsageRenderAttachment,
+}
+
+func parseTextureFormat(name string) (wgpu.TextureFormat, bool) {
+	if name == "" {
+		return wgpu.TextureFormatUndefined, false
+	}
+	for f := wgpu.TextureFormatR8Unorm; f <= wgpu.TextureFormatASTC12x12UnormSrgb; f++ {
+		if f.String() == name {
+			return f, true
+		}
+	}
+	return wgpu.TextureFormatUndefined, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toFloats(v any, n int) ([]float32, bool) {
+	out := make([]float32, 0, n)
+
+	switch list := v.(type) {
+	case []float32:
+		out = append(out, list...)
+	case []float64:
+		for _, f := range list {
+			out = append(out, float32(f))
+		}
+	case [2]float32:
+		out = append(out, list[:]...)
+	case [4]float32:
+		out = append(out, list[:]...)
+	case []any:
+		for _, e := range list {
+			f, ok := toFloat(e)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, float32(f))
+		}
+	default:
+		return nil, false
+	}
+
+	return out, len(out) == n
+}
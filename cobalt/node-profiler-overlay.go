@@ -0,0 +1,323 @@
+package cobalt
+
+import (
+	_ "embed"
+	"time"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Draws ProfileReport as a bar chart over the frame, for watching the cost of each node while playing. Add it last,
+after anything that clears the window (e.g. the upscale node), and enable profiling (see EnableProfiling).
+
+The top bar stacks every node's average, the rows below it are one per node in render order: the bar is the
+average and the white tick the worst frame. The white line across the rows marks Budget. Row colors repeat every
+8 nodes; print ProfileReport to put names on them.
+*/
+
+//go:embed node-profiler-overlay.wgsl
+var profilerOverlayWGSL string
+
+const (
+	overlayRects      = 512 // most rects drawn per frame
+	overlayRectStride = 32  // clip space bounds + color
+)
+
+var overlayPalette = [...][4]float32{
+	{0.90, 0.30, 0.25, 1},
+	{0.25, 0.65, 0.90, 1},
+	{0.40, 0.80, 0.30, 1},
+	{0.95, 0.75, 0.20, 1},
+	{0.70, 0.40, 0.90, 1},
+	{0.20, 0.80, 0.75, 1},
+	{0.95, 0.50, 0.75, 1},
+	{0.60, 0.60, 0.60, 1},
+}
+
+type ProfilerOverlayNode struct {
+	Budget    time.Duration // the frame time the full bar width stands for. defaults to 1/60s
+	Origin    [2]float32    // top left corner, in window points
+	Width     float32       // bar width at Budget, in window points. defaults to 240. bars past 1.5x Budget are cut off
+	RowHeight float32       // in window points. defaults to 6
+
+	Pipeline       *wgpu.RenderPipeline
+	InstanceBuffer *wgpu.Buffer // one rect per instance
+
+	pipelineLayout *wgpu.PipelineLayout
+
+	disabled bool // see SetEnabled
+}
+
+func newProfilerOverlayNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:profilerOverlay", options)
+	t := &ProfilerOverlayNode{
+		Budget:    time.Duration(r.float("budget", 1000.0/60) * float64(time.Millisecond)),
+		Origin:    r.vec2("origin", [2]float32{8, 8}),
+		Width:     float32(r.float("width", 240)),
+		RowHeight: float32(r.float("rowHeight", 6)),
+	}
+	return t, r.done()
+}
+
+func (t *ProfilerOverlayNode) Options() map[string]any {
+	return map[string]any{
+		"budget":    float64(t.Budget) / float64(time.Millisecond),
+		"origin":    vec2Option(t.Origin),
+		"width":     t.Width,
+		"rowHeight": t.RowHeight,
+	}
+}
+
+func (t *ProfilerOverlayNode) Init(c *State) error {
+	instanceBuffer, err := createBufferInit(c, t, &wgpu.BufferInitDescriptor{
+		Label:    "profiler overlay rects",
+		Contents: make([]byte, overlayRects*overlayRectStride),
+		Usage:    wgpu.BufferUsageVertex | wgpu.BufferUsageCopyDst,
+	})
+	if err != nil {
+		return err
+	}
+	t.InstanceBuffer = instanceBuffer
+
+	pipelineLayout, err := c.Device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{})
+	if err != nil {
+		return err
+	}
+	t.pipelineLayout = pipelineLayout
+
+	return t.buildPipeline(c)
+}
+
+// (re)compile the overlay shader and pipeline. on failure the previous pipeline is kept
+func (t *ProfilerOverlayNode) buildPipeline(c *State) error {
+	shader, err := c.Device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
+		Label: "node-profiler-overlay.wgsl",
+		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{
+			Code: shaderSource(c, "node-profiler-overlay.wgsl", profilerOverlayWGSL),
+		},
+	})
+	if err != nil {
+		logger(c).Error("shader compilation failed", "shader", "node-profiler-overlay.wgsl", "err", err)
+		return err
+	}
+	defer shader.Release()
+
+	pipeline, err := c.Device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
+		Label:  "profiler overlay",
+		Layout: t.pipelineLayout,
+		Vertex: wgpu.VertexState{
+			Module:     shader,
+			EntryPoint: "vs_main",
+			Buffers: []wgpu.VertexBufferLayout{
+				{
+					ArrayStride: overlayRectStride,
+					StepMode:    wgpu.VertexStepModeInstance,
+					Attributes: []wgpu.VertexAttribute{
+						{Format: wgpu.VertexFormatFloat32x4, Offset: 0, ShaderLocation: 0},
+						{Format: wgpu.VertexFormatFloat32x4, Offset: 16, ShaderLocation: 1},
+					},
+				},
+			},
+		},
+		Fragment: &wgpu.FragmentState{
+			Module:     shader,
+			EntryPoint: "fs_main",
+			Targets: []wgpu.ColorTargetState{
+				{
+					Format:    c.Config.Format,
+					WriteMask: wgpu.ColorWriteMaskAll,
+					Blend: &wgpu.BlendState{
+						Color: wgpu.BlendComponent{
+							SrcFactor: wgpu.BlendFactorSrcAlpha,
+							DstFactor: wgpu.BlendFactorOneMinusSrcAlpha,
+						},
+						Alpha: wgpu.BlendComponent{
+							SrcFactor: wgpu.BlendFactorZero,
+							DstFactor: wgpu.BlendFactorOne,
+						},
+					},
+				},
+			},
+		},
+		Primitive: wgpu.PrimitiveState{
+			Topology:  wgpu.PrimitiveTopologyTriangleList,
+			CullMode:  wgpu.CullModeNone,
+			FrontFace: wgpu.FrontFaceCCW,
+		},
+		Multisample: wgpu.MultisampleState{
+			Count: 1,
+			Mask:  0xFFFFFFFF,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+	}
+	t.Pipeline = pipeline
+
+	return nil
+}
+
+func (t *ProfilerOverlayNode) WatchedFiles(c *State) []string {
+	return watchList(shaderOverride(c, "node-profiler-overlay.wgsl"))
+}
+
+func (t *ProfilerOverlayNode) Reload(c *State, path string) error {
+	return t.buildPipeline(c)
+}
+
+func (t *ProfilerOverlayNode) OnSurfaceFormat(c *State) error {
+	return t.buildPipeline(c)
+}
+
+func (t *ProfilerOverlayNode) GetType() string {
+	return "cobalt:profilerOverlay"
+}
+
+func (t *ProfilerOverlayNode) IsEnabled() bool {
+	return !t.disabled
+}
+
+func (t *ProfilerOverlayNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
+}
+
+// view is the backing frame texture view that is created each frame
+func (t *ProfilerOverlayNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.TextureView) error {
+	rects := t.layout(c, ProfileReport(c))
+	if len(rects) == 0 {
+		return nil
+	}
+
+	// pixels -> clip space
+	w, h := float32(c.Config.Width), float32(c.Config.Height)
+	data := make([]byte, len(rects)*overlayRectStride)
+	for i, r := range rects {
+		off := i * overlayRectStride
+		putF32(data, off, r.bounds[0]/w*2-1)
+		putF32(data, off+4, 1-r.bounds[1]/h*2)
+		putF32(data, off+8, r.bounds[2]/w*2-1)
+		putF32(data, off+12, 1-r.bounds[3]/h*2)
+		for j, v := range r.color {
+			putF32(data, off+16+j*4, v)
+		}
+	}
+	if err := c.Queue.WriteBuffer(t.InstanceBuffer, 0, data); err != nil {
+		return err
+	}
+
+	renderPass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
+		Label: "profiler overlay renderpass",
+		ColorAttachments: []wgpu.RenderPassColorAttachment{
+			{
+				View:    view,
+				LoadOp:  wgpu.LoadOpLoad,
+				StoreOp: wgpu.StoreOpStore,
+			},
+		},
+	})
+	defer renderPass.Release()
+
+	renderPass.SetPipeline(t.Pipeline)
+	renderPass.SetVertexBuffer(0, t.InstanceBuffer, 0, uint64(len(data)))
+	renderPass.Draw(6, uint32(len(rects)), 0, 0)
+
+	return renderPass.End()
+}
+
+type overlayRect struct {
+	bounds [4]float32 // left, top, right, bottom in surface pixels
+	color  [4]float32
+}
+
+// the chart for a report, in surface pixels
+func (t *ProfilerOverlayNode) layout(c *State, r Profile) []overlayRect {
+	if len(r.Nodes) == 0 {
+		return nil
+	}
+
+	budget := t.Budget
+	if budget <= 0 {
+		budget = time.Second / 60
+	}
+
+	// options are in window points, the surface may have more pixels per point
+	scale := c.contentScale
+	if scale[0] <= 0 || scale[1] <= 0 {
+		scale = [2]float32{1, 1}
+	}
+	width, rowHeight := t.Width, t.RowHeight
+	if width <= 0 {
+		width = 240
+	}
+	if rowHeight <= 0 {
+		rowHeight = 6
+	}
+
+	x0, y0 := t.Origin[0]*scale[0], t.Origin[1]*scale[1]
+	width *= scale[0]
+	rowHeight = max(rowHeight*scale[1], 1)
+	gap := max(rowHeight/3, 1)
+	pad := 2 * gap
+
+	limit := width * 1.5
+	barWidth := func(d time.Duration) float32 {
+		return min(float32(d)/float32(budget)*width, limit)
+	}
+
+	rows := min(len(r.Nodes), overlayRects/3-3)
+	height := float32(rows+1)*(rowHeight+gap) + gap // stacked bar, then one row per node
+
+	rects := []overlayRect{
+		{bounds: [4]float32{x0 - pad, y0 - pad, x0 + limit + pad, y0 + height + pad}, color: [4]float32{0, 0, 0, 0.6}},
+	}
+
+	x := x0
+	for i, n := range r.Nodes[:rows] {
+		w := min(barWidth(n.Average), x0+limit-x)
+		rects = append(rects, overlayRect{bounds: [4]float32{x, y0, x + w, y0 + rowHeight}, color: overlayPalette[i%len(overlayPalette)]})
+		x += w
+	}
+
+	for i, n := range r.Nodes[:rows] {
+		y := y0 + float32(i+1)*(rowHeight+gap) + gap
+		color := overlayPalette[i%len(overlayPalette)]
+		rects = append(rects, overlayRect{bounds: [4]float32{x0, y, x0 + barWidth(n.Average), y + rowHeight}, color: color})
+
+		tick := x0 + barWidth(n.Max)
+		rects = append(rects, overlayRect{bounds: [4]float32{tick - scale[0], y, tick + scale[0], y + rowHeight}, color: [4]float32{1, 1, 1, 0.9}})
+	}
+
+	// the budget line
+	rects = append(rects, overlayRect{bounds: [4]float32{x0 + width - scale[0]/2, y0 - gap, x0 + width + scale[0]/2, y0 + height}, color: [4]float32{1, 1, 1, 0.8}})
+
+	return rects
+}
+
+func (t *ProfilerOverlayNode) OnDestroy(c *State) error {
+	releaseBuffer(c, t.InstanceBuffer)
+	t.InstanceBuffer = nil
+
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+		t.Pipeline = nil
+	}
+	if t.pipelineLayout != nil {
+		t.pipelineLayout.Release()
+		t.pipelineLayout = nil
+	}
+
+	return nil
+}
+
+func (t *ProfilerOverlayNode) OnViewportPosition(c *State) error {
+	return nil
+}
+
+func (t *ProfilerOverlayNode) OnResize(c *State) error {
+	return nil
+}
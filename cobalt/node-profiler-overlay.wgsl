@@ -0,0 +1,36 @@
+struct Rect {
+    @location(0) Bounds: vec4<f32>, // left, top, right, bottom in clip space
+    @location(1) Color: vec4<f32>,
+};
+
+struct Fragment {
+    @builtin(position) Position : vec4<f32>,
+    @location(0) Color : vec4<f32>
+};
+
+
+@vertex
+fn vs_main (@builtin(vertex_index) VertexIndex : u32, rect: Rect) -> Fragment  {
+    // two triangles per rect
+    var corners = array<vec2<f32>, 6>(
+        vec2<f32>(0.0, 0.0),
+        vec2<f32>(1.0, 0.0),
+        vec2<f32>(0.0, 1.0),
+        vec2<f32>(0.0, 1.0),
+        vec2<f32>(1.0, 0.0),
+        vec2<f32>(1.0, 1.0),
+    );
+
+    var output : Fragment;
+
+    output.Position = vec4<f32>(mix(rect.Bounds.xy, rect.Bounds.zw, corners[VertexIndex]), 0.0, 1.0);
+    output.Color = rect.Color;
+
+    return output;
+}
+
+
+@fragment
+fn fs_main (@location(0) Color: vec4<f32>) -> @location(0) vec4<f32> {
+    return Color;
+}
@@ -3,7 +3,6 @@ package cobalt
 import (
 	_ "embed"
 	"encoding/binary"
-	"fmt"
 	"math"
 	"math/rand/v2"
 	"slices"
@@ -49,6 +48,11 @@ type SpriteNode struct {
 	BindGroup *wgpu.BindGroup
 
 	TargetFB *FrameBufferNode
+
+	bindGroupLayout *wgpu.BindGroupLayout
+	pipelineLayout  *wgpu.PipelineLayout
+
+	disabled bool // see SetEnabled
 }
 
 type SpriteInstance struct {
@@ -62,11 +66,29 @@ type SpriteInstance struct {
 	Id       uint32
 }
 
+func newSpriteNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:sprite", options)
+	s := &SpriteNode{
+		Format:        r.format("format", wgpu.TextureFormatRGBA8Unorm),
+		IsScreenSpace: r.bool("isScreenSpace", false),
+		LoadOp:        r.loadOp("loadOp", wgpu.LoadOpLoad),
+	}
+	return s, r.done()
+}
+
+func (s *SpriteNode) Options() map[string]any {
+	return map[string]any{
+		"format":        s.Format.String(),
+		"isScreenSpace": s.IsScreenSpace,
+		"loadOp":        loadOpOption(s.LoadOp),
+	}
+}
+
 func (s *SpriteNode) Init(c *State) error {
 	// 4x4 matrix with 4 bytes per float32, times 2 matrices (view, projection)
 	buf := [64 * 2]byte{}
 
-	uniformBuffer, err := c.Device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+	uniformBuffer, err := createBufferInit(c, s, &wgpu.BufferInitDescriptor{
 		Label:    "SpriteTransform",
 		Contents: wgpu.ToBytes(buf[:]),
 		Usage:    wgpu.BufferUsageUniform | wgpu.BufferUsageCopyDst,
@@ -77,42 +99,16 @@ func (s *SpriteNode) Init(c *State) error {
 
 	s.UniformBuffer = uniformBuffer
 
-	// Pack into std430-like struct (4*float*? + vec2 + vec2 → 32 bytes). We'll just write tightly as 8 floats.
-	const FLOATS_PER_DESC = 8 // 8 float32s
-
-	f32 := make([]float32, FLOATS_PER_DESC*len(s.Spritesheet.Spritetable.Descs))
-
-	for i, d := range s.Spritesheet.Spritetable.Descs {
-		base := i * 8
-
-		f32[base+0] = d.UvOrigin[0]
-		f32[base+1] = d.UvOrigin[1]
-		f32[base+2] = d.UvSpan[0]
-		f32[base+3] = d.UvSpan[1]
-		f32[base+4] = float32(d.FrameSize[0])
-		f32[base+5] = float32(d.FrameSize[1])
-		f32[base+6] = d.CenterOffset[0]
-		f32[base+7] = d.CenterOffset[1]
-	}
-
-	// create buffer for sprite uv lookup
-	spriteBuf, err := c.Device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-		Label:    "srite desc table",
-		Contents: wgpu.ToBytes(f32[:]),
-		Usage:    wgpu.BufferUsageStorage | wgpu.BufferUsageCopyDst,
-	})
-	if err != nil {
+	if err := s.buildSpriteTable(c); err != nil {
 		return err
 	}
 
-	s.SpriteBuffer = spriteBuf
-
 	// --- Instance buffer (growable) ---
 	const instanceCap = 1024
 
 	instanceBytes := make([]byte, INSTANCE_STRIDE*instanceCap)
 
-	instanceBuf, err := c.Device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+	instanceBuf, err := createBufferInit(c, s, &wgpu.BufferInitDescriptor{
 		Label:    "sprite instances",
 		Contents: instanceBytes,
 		Usage:    wgpu.BufferUsageVertex | wgpu.BufferUsageCopyDst,
@@ -164,12 +160,69 @@ func (s *SpriteNode) Init(c *State) error {
 		return err
 	}
 
-	bindGroup, err := c.Device.CreateBindGroup(&wgpu.BindGroupDescriptor{
-		Layout: bindGroupLayout,
+	s.bindGroupLayout = bindGroupLayout
+
+	if err := s.buildBindGroup(c); err != nil {
+		return err
+	}
+
+	// --- pipeline layout (order matters: [tile, atlas]) ---
+	pipelineLayout, err := c.Device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
+		BindGroupLayouts: []*wgpu.BindGroupLayout{bindGroupLayout},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.pipelineLayout = pipelineLayout
+
+	return s.buildPipeline(c)
+}
+
+// (re)build the sprite uv lookup table from the spritesheet
+func (s *SpriteNode) buildSpriteTable(c *State) error {
+	// Pack into std430-like struct (4*float*? + vec2 + vec2 → 32 bytes). We'll just write tightly as 8 floats.
+	const FLOATS_PER_DESC = 8 // 8 float32s
+
+	f32 := make([]float32, FLOATS_PER_DESC*len(s.Spritesheet.Spritetable.Descs))
+
+	for i, d := range s.Spritesheet.Spritetable.Descs {
+		base := i * 8
+
+		f32[base+0] = d.UvOrigin[0]
+		f32[base+1] = d.UvOrigin[1]
+		f32[base+2] = d.UvSpan[0]
+		f32[base+3] = d.UvSpan[1]
+		f32[base+4] = float32(d.FrameSize[0])
+		f32[base+5] = float32(d.FrameSize[1])
+		f32[base+6] = d.CenterOffset[0]
+		f32[base+7] = d.CenterOffset[1]
+	}
+
+	// create buffer for sprite uv lookup
+	spriteBuf, err := createBufferInit(c, s, &wgpu.BufferInitDescriptor{
+		Label:    "srite desc table",
+		Contents: wgpu.ToBytes(f32[:]),
+		Usage:    wgpu.BufferUsageStorage | wgpu.BufferUsageCopyDst,
+	})
+	if err != nil {
+		return err
+	}
+
+	releaseBuffer(c, s.SpriteBuffer)
+	s.SpriteBuffer = spriteBuf
+
+	return nil
+}
+
+// (re)build the bind group, which points at the spritesheet texture and the sprite table
+func (s *SpriteNode) buildBindGroup(c *State) error {
+	bindGroup, err := createBindGroup(c, s, &wgpu.BindGroupDescriptor{
+		Layout: s.bindGroupLayout,
 		Entries: []wgpu.BindGroupEntry{
 			{
 				Binding: 0,
-				Buffer:  uniformBuffer,
+				Buffer:  s.UniformBuffer,
 				Offset:  0,
 				Size:    wgpu.WholeSize, // whole buffer
 			},
@@ -183,7 +236,7 @@ func (s *SpriteNode) Init(c *State) error {
 			},
 			{
 				Binding: 3,
-				Buffer:  spriteBuf,
+				Buffer:  s.SpriteBuffer,
 				Offset:  0,
 				Size:    wgpu.WholeSize, // whole buffer
 			},
@@ -193,33 +246,32 @@ func (s *SpriteNode) Init(c *State) error {
 		return err
 	}
 
+	releaseBindGroup(c, s.BindGroup)
 	s.BindGroup = bindGroup
 
-	// --- pipeline layout (order matters: [tile, atlas]) ---
-	pipelineLayout, err := c.Device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
-		BindGroupLayouts: []*wgpu.BindGroupLayout{bindGroupLayout},
-	})
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
+// (re)compile the sprite shader and pipeline. on failure the previous pipeline is kept
+func (s *SpriteNode) buildPipeline(c *State) error {
 	spriteShader, err := c.Device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
 		Label: "sprite.wgsl",
 		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{
-			Code: spriteWGSL,
+			Code: shaderSource(c, "node-sprite.wgsl", spriteWGSL),
 		},
 	})
 	if err != nil {
-		fmt.Println("shader compilation failed:", err)
+		logger(c).Error("shader compilation failed", "shader", "node-sprite.wgsl", "err", err)
 		return err
 	}
 
 	defer spriteShader.Release()
 
-	fmt.Println("c.Config.Format:", c.Config.Format)
+	_, format, _ := renderTarget(c, s.TargetFB, nil)
+	logger(c).Debug("build sprite pipeline", "format", format)
 
 	pipeline, err := c.Device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
-		Layout: pipelineLayout,
+		Layout: s.pipelineLayout,
 		Vertex: wgpu.VertexState{
 			Module:     spriteShader,
 			EntryPoint: "vs_main",
@@ -245,7 +297,7 @@ func (s *SpriteNode) Init(c *State) error {
 			EntryPoint: "fs_main",
 			Targets: []wgpu.ColorTargetState{
 				{
-					Format:    c.Config.Format,
+					Format:    format,
 					WriteMask: wgpu.ColorWriteMaskAll,
 					Blend: &wgpu.BlendState{
 						Color: wgpu.BlendComponent{
@@ -275,27 +327,63 @@ func (s *SpriteNode) Init(c *State) error {
 		return err
 	}
 
+	if s.Pipeline != nil {
+		s.Pipeline.Release()
+	}
 	s.Pipeline = pipeline
 
 	return nil
 }
 
+// spritesheet changes are picked up through the spritesheet, see SpritesheetNode.Reload
+func (s *SpriteNode) WatchedFiles(c *State) []string {
+	return watchList(shaderOverride(c, "node-sprite.wgsl"))
+}
+
+func (s *SpriteNode) Reload(c *State, path string) error {
+	return s.buildPipeline(c)
+}
+
+// sprites drawn into a framebuffer keep the framebuffer's format
+func (s *SpriteNode) OnSurfaceFormat(c *State) error {
+	if s.TargetFB != nil {
+		return nil
+	}
+	return s.buildPipeline(c)
+}
+
 func (s *SpriteNode) GetType() string {
 	return "cobalt:sprite"
 }
 
 func (s *SpriteNode) IsEnabled() bool {
-	return true
+	return !s.disabled
+}
+
+func (s *SpriteNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, s, &s.disabled, enabled)
 }
 
 // view is the backing frame texture view that is created each frame
 func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.TextureView) error {
 	s.Visible = s.Visible[:0]
 
+	pos := c.Viewport.position()
+	size := c.Viewport.worldSize()
+
+	descs := s.Spritesheet.Spritetable.Descs
+	skipped := 0
+
 	for i := range s.Sprites {
 		sp := s.Sprites[i]
 
-		d := s.Spritesheet.Spritetable.Descs[sp.SpriteID]
+		// e.g. an id from before the spritesheet was reloaded with fewer frames
+		if int(sp.SpriteID) >= len(descs) {
+			skipped++
+			continue
+		}
+
+		d := descs[sp.SpriteID]
 		// avoid sprite viewport culling when drawing in screen space mode (typically ui/hud layers)
 		if !s.IsScreenSpace {
 			sx := float32(d.FrameSize[0]) * sp.Size[0] * sp.Scale[0] * 0.5
@@ -305,10 +393,10 @@ func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Te
 			x := sp.Position[0]
 			y := sp.Position[1]
 
-			if x+rad < float32(c.Viewport.position[0]) ||
-				x-rad > float32(c.Viewport.position[0]+c.Viewport.width) ||
-				y+rad < float32(c.Viewport.position[1]) ||
-				y-rad > float32(c.Viewport.position[1]+c.Viewport.height) {
+			if x+rad < pos[0] ||
+				x-rad > pos[0]+size[0] ||
+				y+rad < pos[1] ||
+				y-rad > pos[1]+size[1] {
 				continue
 			}
 		}
@@ -318,6 +406,10 @@ func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Te
 
 	s.VisibleCount = len(s.Visible)
 
+	if skipped > 0 {
+		logger(c).Debug("sprites with unknown sprite ids skipped", "count", skipped, "spritesheet", len(descs))
+	}
+
 	if s.VisibleCount < 1 {
 		return nil
 	}
@@ -358,13 +450,7 @@ func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Te
 	}
 
 	// if no outview is provided, blit to the device's default frame texture
-	v := view
-
-
-	if s.TargetFB != nil {
-		v = s.TargetFB.Material.View
-		//fmt.Println("rendering to framebuffer", s.TargetFB)
-	}
+	v, _, targetSize := renderTarget(c, s.TargetFB, view)
 
 
 	// on the first render, we should clear the color attachment.
@@ -375,12 +461,13 @@ func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Te
 			{
 				View:       v,
 				ClearValue: wgpu.Color{R: 0.0, G: 0.0, B: 0.0, A: 1.0},
-				LoadOp:     s.LoadOp,
+				LoadOp:     viewLoadOp(c, s.LoadOp),
 				StoreOp:    wgpu.StoreOpStore,
 			},
 		},
 	})
 
+	applyView(c, renderPass, targetSize)
 	renderPass.SetPipeline(s.Pipeline)
 	renderPass.SetBindGroup(0, s.BindGroup, nil)
 	renderPass.SetVertexBuffer(0, s.InstanceBuffer, 0, wgpu.WholeSize)
@@ -391,12 +478,23 @@ func (s *SpriteNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.Te
 }
 
 func (s *SpriteNode) OnDestroy(c *State) error {
-	s.UniformBuffer.Destroy()
-	s.SpriteBuffer.Destroy()
-	s.InstanceBuffer.Destroy()
+	releaseBuffer(c, s.UniformBuffer)
+	releaseBuffer(c, s.SpriteBuffer)
+	releaseBuffer(c, s.InstanceBuffer)
+	s.UniformBuffer, s.SpriteBuffer, s.InstanceBuffer = nil, nil, nil
+
+	releaseBindGroup(c, s.BindGroup)
+	s.BindGroup = nil
 
-	s.Pipeline.Release()
-	s.BindGroup.Release()
+	if s.Pipeline != nil {
+		s.Pipeline.Release()
+		s.Pipeline = nil
+	}
+	if s.pipelineLayout != nil {
+		s.pipelineLayout.Release()
+		s.bindGroupLayout.Release()
+		s.pipelineLayout, s.bindGroupLayout = nil, nil
+	}
 
 	return nil
 }
@@ -409,6 +507,26 @@ func (s *SpriteNode) OnResize(c *State) error {
 	return writeSpriteBuffer(c, s)
 }
 
+func (s *SpriteNode) SetRef(name string, node NodeDefinition) error {
+	switch name {
+	case "spritesheet":
+		ss, ok := node.(*SpritesheetNode)
+		if !ok {
+			return refTypeError(s, name, node)
+		}
+		s.Spritesheet = ss
+	case "target":
+		fb, ok := node.(*FrameBufferNode)
+		if !ok {
+			return refTypeError(s, name, node)
+		}
+		s.TargetFB = fb
+	default:
+		return unknownRefError(s, name)
+	}
+	return nil
+}
+
 func ensureCapacity(c *State, s *SpriteNode, nInstances int) error {
 	if nInstances <= s.InstanceCap {
 		return nil
@@ -436,10 +554,9 @@ func ensureCapacity(c *State, s *SpriteNode, nInstances int) error {
 func writeSpriteBuffer(c *State, s *SpriteNode) error {
 	vp := c.Viewport
 
-	gameW := vp.width / vp.Zoom
-	gameH := vp.height / vp.Zoom
+	game := vp.worldSize()
 
-	projection := mgl32.Ortho(0, float32(gameW), float32(gameH), 0, -10.0, 10.0)
+	projection := mgl32.Ortho(0, game[0], game[1], 0, -10.0, 10.0)
 
 	var tmpVec3 [3]float32
 
@@ -447,14 +564,9 @@ func writeSpriteBuffer(c *State, s *SpriteNode) error {
 	if s.IsScreenSpace {
 		tmpVec3 = [3]float32{0, 0, 0}
 	} else {
-		// JS used round-half-up symmetric; math.Round in Go is half away from zero (good here).
-		tmpVec3 = [3]float32{
-			float32(-math.Round(float64(vp.position[0]))),
-			float32(-math.Round(float64(vp.position[1]))),
-			0,
-		}
-		// Alternative (no rounding):
-		// tmpVec3 = [3]float32{-vp.Position[0], -vp.Position[1], 0}
+		// already rounded according to vp.Snap
+		pos := vp.position()
+		tmpVec3 = [3]float32{-pos[0], -pos[1], 0}
 	}
 
 	view := mgl32.Translate3D(tmpVec3[0], tmpVec3[1], tmpVec3[2])
@@ -462,16 +574,10 @@ func writeSpriteBuffer(c *State, s *SpriteNode) error {
 	// Upload (two back-to-back 4x4 matrices, 64 bytes each)
 	err := c.Queue.WriteBuffer(s.UniformBuffer, 0, wgpu.ToBytes(view[:]))
 	if err != nil {
-		fmt.Println("err1", err)
 		return err
 	}
 
-	err2 := c.Queue.WriteBuffer(s.UniformBuffer, 64, wgpu.ToBytes(projection[:]))
-	if err2 != nil {
-		fmt.Println("err2", err2)
-		return err
-	}
-	return nil
+	return c.Queue.WriteBuffer(s.UniformBuffer, 64, wgpu.ToBytes(projection[:]))
 }
 
 // returns a unique identifier for the created sprite
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	//"fmt"
+	"image"
 	"os"
 	"sort"
 
@@ -62,14 +63,40 @@ type SpritesheetNode struct {
 	ColorTexture        *Texture
 	IdByName            map[string]int
 	Spritetable         *SpriteTable
+
+	// keep a cpu copy of the texture in Pixels, for alpha accurate sprite picking (see PickAlpha)
+	KeepPixels bool
+	Pixels     *image.RGBA
+
+	disabled bool // see SetEnabled
 }
 
-func (s *SpritesheetNode) Init(c *State) error {
-	atlasMaterial, err := CreateTextureFromPath(c, "spritesheet", s.ColorTexturePath, s.Format)
-	if err != nil {
-		return err
+func newSpritesheetNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:spritesheet", options)
+	s := &SpritesheetNode{
+		SpritesheetJsonPath: r.string("spritesheetJsonPath", ""),
+		ColorTexturePath:    r.string("colorTexturePath", ""),
+		Format:              r.format("format", wgpu.TextureFormatRGBA8Unorm),
+		KeepPixels:          r.bool("keepPixels", false),
 	}
+	return s, r.done()
+}
 
+func (s *SpritesheetNode) Options() map[string]any {
+	return map[string]any{
+		"spritesheetJsonPath": s.SpritesheetJsonPath,
+		"colorTexturePath":    s.ColorTexturePath,
+		"format":              s.Format.String(),
+		"keepPixels":          s.KeepPixels,
+	}
+}
+
+func (s *SpritesheetNode) Init(c *State) error {
+	return s.load(c)
+}
+
+// read the json and texture. the current table and texture are only replaced once both loaded
+func (s *SpritesheetNode) load(c *State) error {
 	rawJson, err := os.ReadFile(s.SpritesheetJsonPath)
 	if err != nil {
 		return err
@@ -85,6 +112,16 @@ func (s *SpritesheetNode) Init(c *State) error {
 		return err
 	}
 
+	pixels, err := loadImageRGBA(s.ColorTexturePath)
+	if err != nil {
+		return err
+	}
+
+	atlasMaterial, err := CreateTextureFromImage(c, "spritesheet", pixels, s.Format)
+	if err != nil {
+		return err
+	}
+
 	// Map sprite name → ID
 	idByName := make(map[string]int, len(st.Names))
 
@@ -92,10 +129,51 @@ func (s *SpritesheetNode) Init(c *State) error {
 		idByName[name] = i
 	}
 
+	old := s.ColorTexture
+
 	s.Spritetable = st
+	ownTexture(c, s, atlasMaterial)
 	s.ColorTexture = atlasMaterial
 	s.IdByName = idByName
-	return nil
+
+	s.Pixels = nil
+	if s.KeepPixels {
+		s.Pixels = pixels
+	}
+
+	// the old texture is still bound by the sprite nodes using this sheet, so it goes once they moved on
+	err = s.rebuildSpriteNodes(c)
+	old.Release()
+	return err
+}
+
+// point the initialized sprite nodes drawing from this sheet at its new table and texture
+func (s *SpritesheetNode) rebuildSpriteNodes(c *State) error {
+	var errs []error
+	for _, n := range c.Nodes {
+		sn, ok := n.(*SpriteNode)
+		if !ok || sn.Spritesheet != s || sn.BindGroup == nil {
+			continue
+		}
+
+		err := sn.buildSpriteTable(c)
+		if err == nil {
+			err = sn.buildBindGroup(c)
+		}
+		if err != nil {
+			errs = append(errs, newNodeError(c, sn, PhaseReload, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SpritesheetNode) WatchedFiles(c *State) []string {
+	return watchList(s.SpritesheetJsonPath, s.ColorTexturePath)
+}
+
+// sprite nodes using this sheet get the new table and texture before the old texture is released
+func (s *SpritesheetNode) Reload(c *State, path string) error {
+	return s.load(c)
 }
 
 func (s *SpritesheetNode) GetType() string {
@@ -103,7 +181,11 @@ func (s *SpritesheetNode) GetType() string {
 }
 
 func (s *SpritesheetNode) IsEnabled() bool {
-	return true
+	return !s.disabled
+}
+
+func (s *SpritesheetNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, s, &s.disabled, enabled)
 }
 
 // view is the backing frame texture view that is created each frame
@@ -115,7 +197,7 @@ func (s *SpritesheetNode) OnDestroy(c *State) error {
 	if s.ColorTexture == nil {
 		return nil
 	}
-	s.ColorTexture.Texture.Release()
+	s.ColorTexture.Release()
 	s.ColorTexture = nil
 	return nil
 }
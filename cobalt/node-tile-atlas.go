@@ -4,7 +4,6 @@ package cobalt
 import (
 	_ "embed"
 	"encoding/binary"
-	"fmt"
 	"math"
 
 	"github.com/cogentcore/webgpu/wgpu"
@@ -14,7 +13,7 @@ import (
 var tileWGSL string
 
 type TileAtlasNode struct {
-	Pipeline            *wgpu.RenderPipeline
+	Pipeline            *wgpu.RenderPipeline // pipeline for the swapchain format (c.Config.Format)
 	UniformBuffer       *wgpu.Buffer
 	AtlasBindGroup      *wgpu.BindGroup // tile atlas texture, transform UBO
 	TileBindGroupLayout wgpu.BindGroupLayout
@@ -23,6 +22,42 @@ type TileAtlasNode struct {
 	TexturePath         string
 	Format              wgpu.TextureFormat
 	AtlasMaterial       *Texture
+
+	PropertiesPath string                 // optional json file with per-tile collision properties
+	TileProps      map[int]TileProperties // keyed by tile id (see TileID)
+
+	atlasBindGroupLayout *wgpu.BindGroupLayout
+	pipelineLayout       *wgpu.PipelineLayout
+	pipelines            map[wgpu.TextureFormat]*wgpu.RenderPipeline // one per render target format
+
+	viewPos [2]float32 // viewport position in the uniform buffer, used by the tile queries
+
+	disabled bool // see SetEnabled
+}
+
+func newTileAtlasNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:tileAtlas", options)
+	t := &TileAtlasNode{
+		TexturePath:    r.string("texturePath", ""),
+		PropertiesPath: r.string("propertiesPath", ""),
+		Format:         r.format("format", wgpu.TextureFormatRGBA8Unorm),
+		TileSize:       r.int("tileSize", 16),
+		TileScale:      r.float("tileScale", 1.0),
+	}
+	return t, r.done()
+}
+
+func (t *TileAtlasNode) Options() map[string]any {
+	o := map[string]any{
+		"texturePath": t.TexturePath,
+		"format":      t.Format.String(),
+		"tileSize":    t.TileSize,
+		"tileScale":   t.TileScale,
+	}
+	if t.PropertiesPath != "" {
+		o["propertiesPath"] = t.PropertiesPath
+	}
+	return o
 }
 
 func (t *TileAtlasNode) Init(c *State) error {
@@ -31,11 +66,20 @@ func (t *TileAtlasNode) Init(c *State) error {
 		return err
 	}
 
+	ownTexture(c, t, atlasMaterial)
 	t.AtlasMaterial = atlasMaterial
 
+	if t.PropertiesPath != "" {
+		props, err := loadTileProperties(t.PropertiesPath)
+		if err != nil {
+			return err
+		}
+		t.TileProps = props
+	}
+
 	buf := [32]byte{} // 332 + 16 *32 in bytes. 32 for common data + (32 max tilelayers * 16 bytes per layer)
 
-	uniformBuffer, err := c.Device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+	uniformBuffer, err := createBufferInit(c, t, &wgpu.BufferInitDescriptor{
 		Label:    "TileAtlasBuffer",
 		Contents: wgpu.ToBytes(buf[:]),
 		Usage:    wgpu.BufferUsageUniform | wgpu.BufferUsageCopyDst,
@@ -80,31 +124,12 @@ func (t *TileAtlasNode) Init(c *State) error {
 		return err
 	}
 
-	atlasBG, err := c.Device.CreateBindGroup(&wgpu.BindGroupDescriptor{
-		Layout: atlasBGL,
-		Entries: []wgpu.BindGroupEntry{
-			{
-				Binding: 0,
-				Buffer:  uniformBuffer,
-				Offset:  0,
-				Size:    wgpu.WholeSize, // whole buffer
-			},
-			{
-				Binding:     1,
-				TextureView: atlasMaterial.View,
-			},
-			{
-				Binding: 2,
-				Sampler: atlasMaterial.Sampler,
-			},
-		},
-	})
-	if err != nil {
+	t.atlasBindGroupLayout = atlasBGL
+
+	if err := t.buildAtlasBindGroup(c); err != nil {
 		return err
 	}
 
-	t.AtlasBindGroup = atlasBG
-
 	tileBGL, err := c.Device.CreateBindGroupLayout(&wgpu.BindGroupLayoutDescriptor{
 		Entries: []wgpu.BindGroupLayoutEntry{
 			{
@@ -148,15 +173,76 @@ func (t *TileAtlasNode) Init(c *State) error {
 		return err
 	}
 
+	t.pipelineLayout = pipelineLayout
+	t.pipelines = make(map[wgpu.TextureFormat]*wgpu.RenderPipeline)
+
+	pipeline, err := t.getPipeline(c, c.Config.Format)
+	if err != nil {
+		return err
+	}
+
+	t.Pipeline = pipeline
+
+	return nil
+}
+
+// (re)build the bind group for the atlas texture and transform UBO
+func (t *TileAtlasNode) buildAtlasBindGroup(c *State) error {
+	atlasBG, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
+		Layout: t.atlasBindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{
+				Binding: 0,
+				Buffer:  t.UniformBuffer,
+				Offset:  0,
+				Size:    wgpu.WholeSize, // whole buffer
+			},
+			{
+				Binding:     1,
+				TextureView: t.AtlasMaterial.View,
+			},
+			{
+				Binding: 2,
+				Sampler: t.AtlasMaterial.Sampler,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	releaseBindGroup(c, t.AtlasBindGroup)
+	t.AtlasBindGroup = atlasBG
+
+	return nil
+}
+
+// tile layers can render into the swapchain or into framebuffers with other formats,
+// so pipelines are built lazily for each target format and cached.
+func (t *TileAtlasNode) getPipeline(c *State, format wgpu.TextureFormat) (*wgpu.RenderPipeline, error) {
+	if p, ok := t.pipelines[format]; ok {
+		return p, nil
+	}
+
+	pipeline, err := t.buildPipeline(c, format)
+	if err != nil {
+		return nil, err
+	}
+
+	t.pipelines[format] = pipeline
+	return pipeline, nil
+}
+
+func (t *TileAtlasNode) buildPipeline(c *State, format wgpu.TextureFormat) (*wgpu.RenderPipeline, error) {
 	drawShader, err := c.Device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
 		Label: "tile.wgsl",
 		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{
-			Code: tileWGSL,
+			Code: shaderSource(c, "node-tile.wgsl", tileWGSL),
 		},
 	})
 	if err != nil {
-		fmt.Println("shader compilation failed:", err)
-		return err
+		logger(c).Error("shader compilation failed", "shader", "node-tile.wgsl", "err", err)
+		return nil, err
 	}
 	defer drawShader.Release()
 
@@ -173,9 +259,9 @@ func (t *TileAtlasNode) Init(c *State) error {
 		},
 	}
 
-   fmt.Println("heres the color target:", c.Config.Format)
+	logger(c).Debug("build tile pipeline", "format", format)
 	colorTarget := wgpu.ColorTargetState{
-		Format:    c.Config.Format,
+		Format:    format,
 		Blend:     blend,
 		WriteMask: wgpu.ColorWriteMaskAll,
 	}
@@ -183,7 +269,7 @@ func (t *TileAtlasNode) Init(c *State) error {
 	// --- pipeline ---
 	pipeline, err := c.Device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
 		Label:  "tileatlas",
-		Layout: pipelineLayout,
+		Layout: t.pipelineLayout,
 		Vertex: wgpu.VertexState{
 			Module:     drawShader,
 			EntryPoint: "vs_main",
@@ -205,11 +291,73 @@ func (t *TileAtlasNode) Init(c *State) error {
 		},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	t.Pipeline = pipeline
+	return pipeline, nil
+}
+
+func (t *TileAtlasNode) WatchedFiles(c *State) []string {
+	return watchList(t.TexturePath, t.PropertiesPath, shaderOverride(c, "node-tile.wgsl"))
+}
+
+// tile layers bind AtlasBindGroup and ask for pipelines each frame, so they pick up the changes without rebuilding
+func (t *TileAtlasNode) Reload(c *State, path string) error {
+	switch path {
+	case t.TexturePath:
+		material, err := CreateTextureFromPath(c, "tile atlas", t.TexturePath, t.Format)
+		if err != nil {
+			return err
+		}
+		ownTexture(c, t, material)
+
+		old := t.AtlasMaterial
+		t.AtlasMaterial = material
+		if err := t.buildAtlasBindGroup(c); err != nil {
+			t.AtlasMaterial = old
+			material.Release()
+			return err
+		}
+		old.Release()
+
+	case t.PropertiesPath:
+		props, err := loadTileProperties(t.PropertiesPath)
+		if err != nil {
+			return err
+		}
+		t.TileProps = props
+
+	default:
+		// shader. every cached format is rebuilt, and nothing is swapped unless they all compile
+		pipelines := make(map[wgpu.TextureFormat]*wgpu.RenderPipeline, len(t.pipelines))
+		for format := range t.pipelines {
+			p, err := t.buildPipeline(c, format)
+			if err != nil {
+				for _, built := range pipelines {
+					built.Release()
+				}
+				return err
+			}
+			pipelines[format] = p
+		}
+
+		for _, p := range t.pipelines {
+			p.Release()
+		}
+		t.pipelines = pipelines
+		t.Pipeline = pipelines[c.Config.Format]
+	}
+
+	return nil
+}
 
+// pipelines for the old format stay cached, they're still used by layers that draw into framebuffers
+func (t *TileAtlasNode) OnSurfaceFormat(c *State) error {
+	pipeline, err := t.getPipeline(c, c.Config.Format)
+	if err != nil {
+		return err
+	}
+	t.Pipeline = pipeline
 	return nil
 }
 
@@ -218,7 +366,11 @@ func (t *TileAtlasNode) GetType() string {
 }
 
 func (t *TileAtlasNode) IsEnabled() bool {
-	return true
+	return !t.disabled
+}
+
+func (t *TileAtlasNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
 }
 
 func (t *TileAtlasNode) OnRun(c *State, encoder *wgpu.CommandEncoder, tv *wgpu.TextureView) error {
@@ -226,10 +378,28 @@ func (t *TileAtlasNode) OnRun(c *State, encoder *wgpu.CommandEncoder, tv *wgpu.T
 }
 
 func (t *TileAtlasNode) OnDestroy(c *State) error {
-	if t.AtlasMaterial == nil {
-		return nil
+	for format, p := range t.pipelines {
+		p.Release()
+		delete(t.pipelines, format)
+	}
+	t.Pipeline = nil
+
+	if t.pipelineLayout != nil {
+		t.pipelineLayout.Release()
+		t.pipelineLayout = nil
+		t.TileBindGroupLayout.Release()
 	}
-	t.AtlasMaterial.Texture.Release()
+	if t.atlasBindGroupLayout != nil {
+		t.atlasBindGroupLayout.Release()
+		t.atlasBindGroupLayout = nil
+	}
+
+	releaseBindGroup(c, t.AtlasBindGroup)
+	releaseBuffer(c, t.UniformBuffer)
+	t.AtlasMaterial.Release()
+
+	t.AtlasBindGroup = nil
+	t.UniformBuffer = nil
 	t.AtlasMaterial = nil
 	return nil
 }
@@ -244,14 +414,15 @@ func (t *TileAtlasNode) OnResize(c *State) error {
 
 func _writeTileBuffer(c *State, t *TileAtlasNode) error {
 	// c.Viewport.Position is the top left visible corner of the level
-	GAME_WIDTH := float64(c.Viewport.width) / float64(c.Viewport.Zoom)
-	GAME_HEIGHT := float64(c.Viewport.height) / float64(c.Viewport.Zoom)
-	viewportWidth := float32(GAME_WIDTH / t.TileScale)
-	viewportHeight := float32(GAME_HEIGHT / t.TileScale)
+	game := c.Viewport.worldSize()
+	pos := c.Viewport.position()
+	t.viewPos = pos
+	viewportWidth := float32(float64(game[0]) / t.TileScale)
+	viewportHeight := float32(float64(game[1]) / t.TileScale)
 	inverseTileSize := 1.0 / t.TileSize
 	_buf := [8]float32{
-		float32(c.Viewport.position[0]),
-		float32(c.Viewport.position[1]),
+		pos[0],
+		pos[1],
 		viewportWidth,
 		viewportHeight,
 		1.0 / float32(t.AtlasMaterial.Size.Width),
@@ -0,0 +1,535 @@
+package cobalt
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Chunked tile layers draw the same way as `TileLayerNode`, but split the layer lookup texture into fixed size
+chunks instead of uploading the whole map as one texture. This keeps huge worlds under the device's max texture
+dimension, and only the chunks around the viewport are resident on the gpu.
+
+Chunks are cut from an in-memory `Source` image, or requested from a `Loader` callback as the viewport moves.
+Each visible chunk is drawn with the shared tile atlas pipeline, clipped to its screen rectangle with a scissor.
+*/
+
+const DEFAULT_CHUNK_SIZE = 64
+
+// returns the lookup image for chunk (cx, cy), ChunkSize x ChunkSize pixels.
+// returning a nil image marks the chunk as empty.
+type ChunkLoader func(cx int, cy int) (*image.RGBA, error)
+
+type ChunkedTileLayerNode struct {
+	TileAtlas *TileAtlasNode
+	Format    wgpu.TextureFormat
+
+	ChunkSize  int // width and height of a chunk, in tiles
+	LoadMargin int // extra ring of chunks kept loaded around the visible ones
+
+	Source      *image.RGBA // the whole layer lookup image, kept in memory
+	TexturePath string      // where Source was loaded from, when created from options
+	Loader      ChunkLoader // used when Source is nil
+	MapSize     [2]int      // layer size in tiles. taken from Source when set, zero means unbounded
+
+	ScrollScale  [2]float32
+	ScrollOffset [2]float32
+	Tint         [4]float32
+
+	// the framebuffer this layer renders into. when nil, the layer draws into the swapchain view
+	TargetFB   *FrameBufferNode
+	LoadOp     wgpu.LoadOp // LoadOpUndefined behaves like LoadOpLoad
+	ClearValue wgpu.Color  // used when LoadOp is LoadOpClear
+
+	transparency float32 // 1 - opacity, see TileLayerNode
+
+	chunks  map[[2]int]*tileChunk
+	visible [][2]int // chunks overlapping the viewport, updated on viewport changes
+
+	disabled bool // see SetEnabled
+}
+
+type tileChunk struct {
+	Cells         *image.RGBA // nil when the chunk is empty
+	Material      *Texture
+	UniformBuffer *wgpu.Buffer
+	BindGroup     *wgpu.BindGroup
+}
+
+// the options form loads the whole layer from texturePath and streams chunks from memory
+func newChunkedTileLayerNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:tileChunked", options)
+	path := r.string("texturePath", "")
+	t := &ChunkedTileLayerNode{
+		Format:       r.format("format", wgpu.TextureFormatRGBA8Unorm),
+		ChunkSize:    r.int("chunkSize", DEFAULT_CHUNK_SIZE),
+		LoadMargin:   r.int("loadMargin", 0),
+		ScrollScale:  r.vec2("scrollScale", [2]float32{1, 1}),
+		ScrollOffset: r.vec2("scrollOffset", [2]float32{}),
+		Tint:         r.vec4("tint", [4]float32{}),
+		LoadOp:       r.loadOp("loadOp", wgpu.LoadOpLoad),
+		ClearValue:   r.color("clearValue", wgpu.Color{A: 1}),
+		transparency: 1 - float32(r.float("opacity", 1)),
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	source, err := loadImageRGBA(path)
+	if err != nil {
+		return nil, err
+	}
+	t.Source = source
+	t.TexturePath = path
+
+	return t, nil
+}
+
+// layers streamed from a Loader have no texturePath, so they can't be recreated from a scene file
+func (t *ChunkedTileLayerNode) CheckOptions() error {
+	if t.TexturePath == "" {
+		return errors.New("chunked tile layer has no texturePath (it was built from a Loader or Source image)")
+	}
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) Options() map[string]any {
+	return map[string]any{
+		"texturePath":  t.TexturePath,
+		"format":       t.Format.String(),
+		"chunkSize":    t.ChunkSize,
+		"loadMargin":   t.LoadMargin,
+		"scrollScale":  vec2Option(t.ScrollScale),
+		"scrollOffset": vec2Option(t.ScrollOffset),
+		"tint":         vec4Option(t.Tint),
+		"opacity":      t.Opacity(),
+		"loadOp":       loadOpOption(t.LoadOp),
+		"clearValue":   colorOption(t.ClearValue),
+	}
+}
+
+func (t *ChunkedTileLayerNode) Init(c *State) error {
+	if t.ChunkSize <= 0 {
+		t.ChunkSize = DEFAULT_CHUNK_SIZE
+	}
+
+	if t.Source == nil && t.Loader == nil {
+		return errors.New("chunked tile layer needs a Source image or a Loader")
+	}
+	if t.TileAtlas == nil {
+		return errors.New("chunked tile layer needs a TileAtlas")
+	}
+
+	if t.Source != nil {
+		t.MapSize = [2]int{t.Source.Bounds().Dx(), t.Source.Bounds().Dy()}
+	}
+
+	t.chunks = make(map[[2]int]*tileChunk)
+
+	// load what's in view now rather than waiting for the next resize or viewport change
+	return t.updateChunks(c)
+}
+
+// layers fed by a Loader have no TexturePath, so nothing is watched
+func (t *ChunkedTileLayerNode) WatchedFiles(c *State) []string {
+	return watchList(t.TexturePath)
+}
+
+// swap in the new source and rebuild the resident chunks from it
+func (t *ChunkedTileLayerNode) Reload(c *State, path string) error {
+	source, err := loadImageRGBA(path)
+	if err != nil {
+		return err
+	}
+	t.Source = source
+	t.MapSize = [2]int{source.Bounds().Dx(), source.Bounds().Dy()}
+
+	t.unloadAll(c)
+	return t.updateChunks(c)
+}
+
+func (t *ChunkedTileLayerNode) GetType() string {
+	return "cobalt:tileChunked"
+}
+
+func (t *ChunkedTileLayerNode) IsEnabled() bool {
+	return !t.disabled
+}
+
+func (t *ChunkedTileLayerNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
+}
+
+func (t *ChunkedTileLayerNode) OnEnable(c *State) error {
+	return t.updateChunks(c)
+}
+
+// chunk textures are rebuilt from Source/Loader, so they don't need to stay resident while disabled
+func (t *ChunkedTileLayerNode) OnDisable(c *State) error {
+	t.unloadAll(c)
+	return nil
+}
+
+// view is the backing frame texture view that is created each frame
+func (t *ChunkedTileLayerNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.TextureView) error {
+	v, format, targetSize := renderTarget(c, t.TargetFB, view)
+
+	// a clearing layer still has to clear when none of its chunks are visible
+	if len(t.visible) == 0 && tileLoadOp(t.LoadOp) != wgpu.LoadOpClear {
+		return nil
+	}
+
+	pipeline, err := t.TileAtlas.getPipeline(c, format)
+	if err != nil {
+		return err
+	}
+
+	// the part of the target this view draws into
+	area := viewArea(c, targetSize)
+	areaX, areaY := float64(area[0]), float64(area[1])
+	targetWidth := float64(area[2])
+	targetHeight := float64(area[3])
+
+	start, size := t.layerView(c.Viewport)
+	chunkPx := float64(t.ChunkSize * t.TileAtlas.TileSize)
+
+	renderPass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
+		Label: "tile chunked",
+		ColorAttachments: []wgpu.RenderPassColorAttachment{
+			{
+				View:       v,
+				ClearValue: t.ClearValue,
+				LoadOp:     viewLoadOp(c, tileLoadOp(t.LoadOp)),
+				StoreOp:    wgpu.StoreOpStore,
+			},
+		},
+	})
+	defer renderPass.Release()
+
+	applyView(c, renderPass, targetSize)
+	renderPass.SetPipeline(pipeline)
+	renderPass.SetBindGroup(1, t.TileAtlas.AtlasBindGroup, nil)
+
+	for _, key := range t.visible {
+		chunk := t.chunks[key]
+		if chunk == nil || chunk.BindGroup == nil {
+			continue
+		}
+
+		// chunk bounds in layer pixels -> target pixels
+		x0 := (float64(key[0])*chunkPx - start[0]) / size[0] * targetWidth
+		y0 := (float64(key[1])*chunkPx - start[1]) / size[1] * targetHeight
+		x1 := (float64(key[0]+1)*chunkPx - start[0]) / size[0] * targetWidth
+		y1 := (float64(key[1]+1)*chunkPx - start[1]) / size[1] * targetHeight
+
+		x0 = math.Max(0, math.Round(x0))
+		y0 = math.Max(0, math.Round(y0))
+		x1 = math.Min(targetWidth, math.Round(x1))
+		y1 = math.Min(targetHeight, math.Round(y1))
+
+		if x1 <= x0 || y1 <= y0 {
+			continue
+		}
+
+		renderPass.SetScissorRect(uint32(areaX+x0), uint32(areaY+y0), uint32(x1-x0), uint32(y1-y0))
+		renderPass.SetBindGroup(0, chunk.BindGroup, nil)
+		renderPass.Draw(3, 1, 0, 0) // fullscreen triangle, clipped to the chunk
+	}
+
+	return renderPass.End()
+}
+
+func (t *ChunkedTileLayerNode) OnDestroy(c *State) error {
+	t.unloadAll(c)
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) OnViewportPosition(c *State) error {
+	return t.updateChunks(c)
+}
+
+func (t *ChunkedTileLayerNode) OnResize(c *State) error {
+	return t.updateChunks(c)
+}
+
+func (t *ChunkedTileLayerNode) SetRef(name string, node NodeDefinition) error {
+	switch name {
+	case "tileAtlas":
+		ta, ok := node.(*TileAtlasNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.TileAtlas = ta
+	case "target":
+		fb, ok := node.(*FrameBufferNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.TargetFB = fb
+	default:
+		return unknownRefError(t, name)
+	}
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) SetScrollScale(c *State, scale [2]float32) error {
+	t.ScrollScale = scale
+	if err := t.writeChunkBuffers(c); err != nil {
+		return err
+	}
+	return t.updateChunks(c)
+}
+
+func (t *ChunkedTileLayerNode) SetScrollOffset(c *State, offset [2]float32) error {
+	t.ScrollOffset = offset
+	if err := t.writeChunkBuffers(c); err != nil {
+		return err
+	}
+	return t.updateChunks(c)
+}
+
+func (t *ChunkedTileLayerNode) SetTint(c *State, tint [4]float32) error {
+	t.Tint = tint
+	return t.writeChunkBuffers(c)
+}
+
+// 1 is fully opaque, 0 invisible. layers start out opaque. may be called before Init
+func (t *ChunkedTileLayerNode) SetOpacity(c *State, opacity float32) error {
+	t.transparency = 1 - opacity
+	return t.writeChunkBuffers(c)
+}
+
+func (t *ChunkedTileLayerNode) Opacity() float32 {
+	return 1 - t.transparency
+}
+
+// number of chunks currently resident on the gpu
+func (t *ChunkedTileLayerNode) LoadedChunks() int {
+	return len(t.chunks)
+}
+
+// top-left corner and size of the area visible in vp, in layer pixels (same space as PixelCoord in node-tile.wgsl)
+func (t *ChunkedTileLayerNode) layerView(vp Viewport) ([2]float64, [2]float64) {
+	game := vp.worldSize()
+	pos := vp.position()
+
+	size := [2]float64{
+		float64(game[0]) / t.TileAtlas.TileScale,
+		float64(game[1]) / t.TileAtlas.TileScale,
+	}
+
+	start := [2]float64{
+		float64(pos[0])*float64(t.ScrollScale[0]) + float64(t.ScrollOffset[0]),
+		float64(pos[1])*float64(t.ScrollScale[1]) + float64(t.ScrollOffset[1]),
+	}
+
+	return start, size
+}
+
+// load chunks that came into range of any view and release the ones that left them all
+func (t *ChunkedTileLayerNode) updateChunks(c *State) error {
+	if t.chunks == nil || t.disabled || c.Viewport.width == 0 || c.Viewport.height == 0 {
+		return nil
+	}
+
+	chunkPx := float64(t.ChunkSize * t.TileAtlas.TileSize)
+
+	t.visible = t.visible[:0]
+
+	wanted := make(map[[2]int]bool)
+	visible := make(map[[2]int]bool)
+
+	for _, vp := range viewports(c) {
+		start, size := t.layerView(vp)
+
+		minX := int(math.Floor(start[0] / chunkPx))
+		minY := int(math.Floor(start[1] / chunkPx))
+		maxX := int(math.Floor((start[0] + size[0]) / chunkPx))
+		maxY := int(math.Floor((start[1] + size[1]) / chunkPx))
+
+		for cy := minY - t.LoadMargin; cy <= maxY+t.LoadMargin; cy++ {
+			for cx := minX - t.LoadMargin; cx <= maxX+t.LoadMargin; cx++ {
+				if !t.inBounds(cx, cy) {
+					continue
+				}
+
+				key := [2]int{cx, cy}
+				wanted[key] = true
+
+				if _, ok := t.chunks[key]; !ok {
+					if err := t.loadChunk(c, key); err != nil {
+						return err
+					}
+				}
+
+				if cx >= minX && cx <= maxX && cy >= minY && cy <= maxY && !visible[key] {
+					visible[key] = true
+					t.visible = append(t.visible, key)
+				}
+			}
+		}
+	}
+
+	for key := range t.chunks {
+		if !wanted[key] {
+			t.unloadChunk(c, key)
+		}
+	}
+
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) inBounds(cx int, cy int) bool {
+	if cx < 0 || cy < 0 {
+		return false
+	}
+	if t.MapSize[0] > 0 && cx*t.ChunkSize >= t.MapSize[0] {
+		return false
+	}
+	if t.MapSize[1] > 0 && cy*t.ChunkSize >= t.MapSize[1] {
+		return false
+	}
+	return true
+}
+
+// the chunk is only stored once it's fully built, so a failed load is retried on the next update
+func (t *ChunkedTileLayerNode) loadChunk(c *State, key [2]int) error {
+	var cells *image.RGBA
+	var err error
+
+	if t.Source != nil {
+		cells = t.cutChunk(key)
+	} else {
+		cells, err = t.Loader(key[0], key[1])
+		if err != nil {
+			return err
+		}
+		if cells != nil && (cells.Bounds().Dx() != t.ChunkSize || cells.Bounds().Dy() != t.ChunkSize) {
+			return fmt.Errorf("chunk %d,%d is %dx%d, expected %dx%d (ChunkSize)", key[0], key[1],
+				cells.Bounds().Dx(), cells.Bounds().Dy(), t.ChunkSize, t.ChunkSize)
+		}
+	}
+
+	// empty chunks stay resident (so they aren't requested again) but have nothing to draw
+	chunk := &tileChunk{Cells: cells}
+	if cells != nil {
+		if err := t.buildChunk(c, key, chunk); err != nil {
+			releaseChunk(c, chunk)
+			return err
+		}
+	}
+
+	t.chunks[key] = chunk
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) buildChunk(c *State, key [2]int, chunk *tileChunk) error {
+	material, err := CreateTextureFromImage(c, "tile chunk", chunk.Cells, t.Format)
+	if err != nil {
+		return err
+	}
+	ownTexture(c, t, material)
+	chunk.Material = material
+
+	uniformBuffer, err := createBufferInit(c, t, &wgpu.BufferInitDescriptor{
+		Label:    "TileChunkBuffer",
+		Contents: t.chunkUniform(key),
+		Usage:    wgpu.BufferUsageUniform | wgpu.BufferUsageCopyDst,
+	})
+	if err != nil {
+		return err
+	}
+	chunk.UniformBuffer = uniformBuffer
+
+	bindGroup, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
+		Layout: &t.TileAtlas.TileBindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{
+				Binding: 0,
+				Buffer:  uniformBuffer,
+				Offset:  0,
+				Size:    wgpu.WholeSize, // whole buffer
+			},
+			{
+				Binding:     1,
+				TextureView: material.View,
+			},
+			{
+				Binding: 2,
+				Sampler: material.Sampler,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	chunk.BindGroup = bindGroup
+
+	return nil
+}
+
+func (t *ChunkedTileLayerNode) unloadAll(c *State) {
+	for key := range t.chunks {
+		t.unloadChunk(c, key)
+	}
+	t.visible = t.visible[:0]
+}
+
+func (t *ChunkedTileLayerNode) unloadChunk(c *State, key [2]int) {
+	chunk := t.chunks[key]
+	delete(t.chunks, key)
+
+	if chunk != nil {
+		releaseChunk(c, chunk)
+	}
+}
+
+// safe on partially built chunks
+func releaseChunk(c *State, chunk *tileChunk) {
+	releaseBindGroup(c, chunk.BindGroup)
+	releaseBuffer(c, chunk.UniformBuffer)
+	chunk.Material.Release()
+	chunk.BindGroup, chunk.UniformBuffer, chunk.Material = nil, nil, nil
+}
+
+// copy one chunk out of the in-memory source. cells outside the map are left empty (255, 255)
+func (t *ChunkedTileLayerNode) cutChunk(key [2]int) *image.RGBA {
+	n := t.ChunkSize
+	cells := image.NewRGBA(image.Rect(0, 0, n, n))
+	draw.Draw(cells, cells.Bounds(), &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 0, A: 255}}, image.Point{}, draw.Src)
+
+	b := t.Source.Bounds()
+	src := image.Rect(b.Min.X+key[0]*n, b.Min.Y+key[1]*n, b.Min.X+(key[0]+1)*n, b.Min.Y+(key[1]+1)*n).Intersect(b)
+	dst := src.Sub(b.Min.Add(image.Pt(key[0]*n, key[1]*n)))
+	draw.Draw(cells, dst, t.Source, src.Min, draw.Src)
+
+	return cells
+}
+
+// each chunk's texture starts at tile 0, so shift the layer offset back by the chunk origin
+func (t *ChunkedTileLayerNode) chunkUniform(key [2]int) []byte {
+	chunkPx := float32(t.ChunkSize * t.TileAtlas.TileSize)
+	offset := [2]float32{
+		t.ScrollOffset[0] - float32(key[0])*chunkPx,
+		t.ScrollOffset[1] - float32(key[1])*chunkPx,
+	}
+	return packTileLayerUniform(t.ScrollScale, offset, t.Tint, t.transparency)
+}
+
+func (t *ChunkedTileLayerNode) writeChunkBuffers(c *State) error {
+	for key, chunk := range t.chunks {
+		if chunk.UniformBuffer == nil {
+			continue
+		}
+		if err := c.Queue.WriteBuffer(chunk.UniformBuffer, 0, t.chunkUniform(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package cobalt
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"time"
 
 	"github.com/cogentcore/webgpu/wgpu"
 )
@@ -20,24 +23,101 @@ which is the typical approach for current state-of-the-art web renderers.
 Inspired by/ported from https://blog.tojicode.com/2012/07/sprite-tile-maps-on-gpu.html
 */
 
+// Packed layer uniform layout: 48 bytes (matches TileLayer in node-tile.wgsl)
+const TILE_LAYER_UNIFORM_SIZE = 48
+
+// Offsets inside the layer uniform (bytes)
+const (
+	OFF_LAYER_SCROLL_SCALE  = 0  // float32x2 (8B)
+	OFF_LAYER_SCROLL_OFFSET = 8  // float32x2 (8B)
+	OFF_LAYER_TINT          = 16 // float32x4 (16B)
+	OFF_LAYER_OPACITY       = 32 // float32 (4B)
+)
+
 type TileLayerNode struct {
 	BindGroup     *wgpu.BindGroup
 	Material      *Texture
 	UniformBuffer *wgpu.Buffer
 	Format        wgpu.TextureFormat
-	ScrollScale   float32
 	TexturePath   string
-	LoadOp        string
 	TileAtlas     *TileAtlasNode
+
+	// cpu copy of the layer lookup texture. each pixel's r,g is the atlas tile it shows (255,255 is empty).
+	// the gpu texture is built from this, and tile queries read it.
+	Cells *image.RGBA
+
+	// the framebuffer this layer renders into. when nil, the layer draws into the swapchain view
+	TargetFB   *FrameBufferNode
+	LoadOp     wgpu.LoadOp // LoadOpUndefined behaves like LoadOpLoad
+	ClearValue wgpu.Color  // used when LoadOp is LoadOpClear
+
+	// per-axis parallax factor applied to the viewport position. [1, 1] scrolls with the world, [0, 0] is fixed to the screen
+	ScrollScale [2]float32
+	// constant offset (in pixels) added after the parallax scale
+	ScrollOffset [2]float32
+	// pixels per second added to the offset each frame (drifting clouds, water, etc.)
+	ScrollVelocity [2]float32
+
+	// rgb is mixed into the tile color by a, same as SpriteInstance.Tint
+	Tint [4]float32
+
+	// 1 - opacity, see SetOpacity. kept inverted so a layer declared without an opacity is visible
+	transparency float32
+
+	// Cells were built or changed in memory (SetCells, SetTile, ClearTile, an Autotiler) and no longer match
+	// TexturePath, which is then neither watched nor saved
+	edited bool
+
+	scrollDrift [2]float32 // accumulated ScrollVelocity movement
+	lastRun     time.Time
+	disabled    bool // see SetEnabled
 	// OutputView    *wgpu.TextureView // the view this tile layer renders into. used to be an HDR intermediate texture
 }
 
+func newTileLayerNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:tile", options)
+	t := &TileLayerNode{
+		TexturePath:    r.string("texturePath", ""),
+		Format:         r.format("format", wgpu.TextureFormatRGBA8Unorm),
+		ScrollScale:    r.vec2("scrollScale", [2]float32{1, 1}),
+		ScrollOffset:   r.vec2("scrollOffset", [2]float32{}),
+		ScrollVelocity: r.vec2("scrollVelocity", [2]float32{}),
+		Tint:           r.vec4("tint", [4]float32{}),
+		LoadOp:         r.loadOp("loadOp", wgpu.LoadOpLoad),
+		ClearValue:     r.color("clearValue", wgpu.Color{A: 1}),
+		transparency:   1 - float32(r.float("opacity", 1)),
+	}
+	return t, r.done()
+}
+
+// a scene only stores texturePath, so cells built or edited in memory can't be saved
+func (t *TileLayerNode) CheckOptions() error {
+	if t.edited {
+		return errors.New("tile layer cells were edited in memory and no longer match its texturePath")
+	}
+	return nil
+}
+
+func (t *TileLayerNode) Options() map[string]any {
+	return map[string]any{
+		"texturePath":    t.TexturePath,
+		"format":         t.Format.String(),
+		"scrollScale":    vec2Option(t.ScrollScale),
+		"scrollOffset":   vec2Option(t.ScrollOffset),
+		"scrollVelocity": vec2Option(t.ScrollVelocity),
+		"tint":           vec4Option(t.Tint),
+		"opacity":        t.Opacity(),
+		"loadOp":         loadOpOption(t.LoadOp),
+		"clearValue":     colorOption(t.ClearValue),
+	}
+}
+
 func (t *TileLayerNode) Init(c *State) error {
-	dat := [2]float32{t.ScrollScale, t.ScrollScale}
+	buf := [TILE_LAYER_UNIFORM_SIZE]byte{}
 
-	uniformBuffer, err := c.Device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+	uniformBuffer, err := createBufferInit(c, t, &wgpu.BufferInitDescriptor{
 		Label:    "TileLayerBuffer",
-		Contents: wgpu.ToBytes(dat[:]),
+		Contents: wgpu.ToBytes(buf[:]),
 		Usage:    wgpu.BufferUsageUniform | wgpu.BufferUsageCopyDst,
 	})
 	if err != nil {
@@ -46,6 +126,18 @@ func (t *TileLayerNode) Init(c *State) error {
 
 	t.UniformBuffer = uniformBuffer
 
+	if err := writeTileLayerBuffer(c, t); err != nil {
+		return err
+	}
+
+	// layers built in memory (e.g. by an Autotiler) have no texture path
+	if t.TexturePath == "" {
+		if t.Cells == nil {
+			return nil
+		}
+		return t.SetCells(c, t.Cells)
+	}
+
 	e := t.SetTexture(c, t.TexturePath)
 	if e != nil {
 		return e
@@ -55,23 +147,39 @@ func (t *TileLayerNode) Init(c *State) error {
 }
 
 func (t *TileLayerNode) SetTexture(c *State, path string) error {
-	if t.Material != nil {
-		t.Material.Texture.Release()
-		t.Material = nil
+	t.TexturePath = path
+	logger(c).Debug("read tile layer texture", "path", t.TexturePath, "format", t.Format)
+
+	cells, err := loadImageRGBA(t.TexturePath)
+	if err != nil {
+		return err
 	}
 
-	t.TexturePath = path
-	fmt.Println("reading tile layer texture from path:", t.TexturePath)
+	if err := t.SetCells(c, cells); err != nil {
+		return err
+	}
+	t.edited = false
+	return nil
+}
 
-	fmt.Println("fmt:", t.Format)
-	material, err := CreateTextureFromPath(c, "tile layer", t.TexturePath, t.Format)
+// replace the layer lookup data with an in-memory image and rebuild the gpu texture from it
+func (t *TileLayerNode) SetCells(c *State, cells *image.RGBA) error {
+	material, err := CreateTextureFromImage(c, "tile layer", cells, t.Format)
 	if err != nil {
 		return err
 	}
+	ownTexture(c, t, material)
 
+	// the old bind group points at the old texture, so both go
+	releaseBindGroup(c, t.BindGroup)
+	t.BindGroup = nil
+	t.Material.Release()
+
+	t.Cells = cells
 	t.Material = material
+	t.edited = true
 
-	bindGroup, err := c.Device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+	bindGroup, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
 		Layout: &t.TileAtlas.TileBindGroupLayout,
 		Entries: []wgpu.BindGroupEntry{
 			{
@@ -98,12 +206,85 @@ func (t *TileLayerNode) SetTexture(c *State, path string) error {
 	return nil
 }
 
+// point cell (x, y) at an atlas tile
+func (t *TileLayerNode) SetTile(c *State, x int, y int, atlas [2]int) error {
+	if !t.putCell(x, y, uint8(atlas[0]), uint8(atlas[1])) {
+		return errors.New("tile cell out of bounds")
+	}
+	return t.uploadCells(c, image.Rect(x, y, x+1, y+1))
+}
+
+// make cell (x, y) empty
+func (t *TileLayerNode) ClearTile(c *State, x int, y int) error {
+	if !t.putCell(x, y, 255, 255) {
+		return errors.New("tile cell out of bounds")
+	}
+	return t.uploadCells(c, image.Rect(x, y, x+1, y+1))
+}
+
+func (t *TileLayerNode) putCell(x int, y int, ax uint8, ay uint8) bool {
+	if t.Cells == nil {
+		return false
+	}
+
+	b := t.Cells.Bounds()
+	if x < 0 || y < 0 || x >= b.Dx() || y >= b.Dy() {
+		return false
+	}
+
+	off := t.Cells.PixOffset(b.Min.X+x, b.Min.Y+y)
+	t.Cells.Pix[off+0] = ax
+	t.Cells.Pix[off+1] = ay
+	t.Cells.Pix[off+3] = 255
+	t.edited = true
+	return true
+}
+
+// copy a region of Cells (in cell coordinates) to the gpu texture
+func (t *TileLayerNode) uploadCells(c *State, rect image.Rectangle) error {
+	if t.Material == nil {
+		return nil
+	}
+	size := image.Rect(0, 0, t.Material.Size.Width, t.Material.Size.Height)
+	if !rect.In(size) {
+		return fmt.Errorf("cells %v are outside of the %dx%d layer texture", rect, size.Dx(), size.Dy())
+	}
+	origin := t.Cells.Bounds().Min
+	return writeTextureRegion(c, t.Material, t.Cells, rect.Add(origin), rect.Min.X, rect.Min.Y)
+}
+
+// reloading TexturePath would throw away cells that were edited since it was loaded
+func (t *TileLayerNode) WatchedFiles(c *State) []string {
+	if t.edited {
+		return nil
+	}
+	return watchList(t.TexturePath)
+}
+
+func (t *TileLayerNode) Reload(c *State, path string) error {
+	return t.SetTexture(c, path)
+}
+
 func (t *TileLayerNode) GetType() string {
 	return "cobalt:tile"
 }
 
 func (t *TileLayerNode) IsEnabled() bool {
-	return true
+	return !t.disabled
+}
+
+func (t *TileLayerNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
+}
+
+// restart the scroll clock, so time spent disabled doesn't jump the layer forward
+func (t *TileLayerNode) OnEnable(c *State) error {
+	t.lastRun = time.Time{}
+	return nil
+}
+
+func (t *TileLayerNode) OnDisable(c *State) error {
+	return nil
 }
 
 // view is the backing frame texture view that is created each frame
@@ -114,32 +295,55 @@ func (t *TileLayerNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu
 		return nil
 	}
 
+	if t.ScrollVelocity != [2]float32{} {
+		now := time.Now()
+		if !t.lastRun.IsZero() {
+			dt := float32(now.Sub(t.lastRun).Seconds())
+			t.scrollDrift[0] += t.ScrollVelocity[0] * dt
+			t.scrollDrift[1] += t.ScrollVelocity[1] * dt
+			if err := writeTileLayerBuffer(c, t); err != nil {
+				return err
+			}
+		}
+		t.lastRun = now
+	}
+
+	v, format, targetSize := renderTarget(c, t.TargetFB, view)
+
+	pipeline, err := t.TileAtlas.getPipeline(c, format)
+	if err != nil {
+		return err
+	}
+
 	// on the first render, we should clear the color attachment.
 	// otherwise load it, so multiple sprite passes can build up data in the color and emissive textures
 	renderPass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
 		Label: "tile",
 		ColorAttachments: []wgpu.RenderPassColorAttachment{
 			{
-				View:    view, // t.OutputView,
-				LoadOp:  wgpu.LoadOpLoad,
-				StoreOp: wgpu.StoreOpStore,
+				View:       v,
+				ClearValue: t.ClearValue,
+				LoadOp:     viewLoadOp(c, tileLoadOp(t.LoadOp)),
+				StoreOp:    wgpu.StoreOpStore,
 			},
 		},
 	})
-	renderPass.SetPipeline(t.TileAtlas.Pipeline)
+	applyView(c, renderPass, targetSize)
+	renderPass.SetPipeline(pipeline)
 	renderPass.SetBindGroup(0, t.BindGroup, nil)
 	renderPass.SetBindGroup(1, t.TileAtlas.AtlasBindGroup, nil)
 	renderPass.Draw(3, 1, 0, 0) // fullscreen triangle
-	_ = renderPass.End()
-	renderPass.Release() // must release
-	return nil
+	defer renderPass.Release()  // must release
+	return renderPass.End()
 }
 
 func (t *TileLayerNode) OnDestroy(c *State) error {
-	if t.Material == nil {
-		return nil
-	}
-	t.Material.Texture.Release()
+	releaseBindGroup(c, t.BindGroup)
+	releaseBuffer(c, t.UniformBuffer)
+	t.Material.Release()
+
+	t.BindGroup = nil
+	t.UniformBuffer = nil
 	t.Material = nil
 	return nil
 }
@@ -151,3 +355,109 @@ func (t *TileLayerNode) OnViewportPosition(c *State) error {
 func (t *TileLayerNode) OnResize(c *State) error {
 	return nil
 }
+
+func (t *TileLayerNode) SetRef(name string, node NodeDefinition) error {
+	switch name {
+	case "tileAtlas":
+		ta, ok := node.(*TileAtlasNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.TileAtlas = ta
+	case "target":
+		fb, ok := node.(*FrameBufferNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.TargetFB = fb
+	default:
+		return unknownRefError(t, name)
+	}
+	return nil
+}
+
+func (t *TileLayerNode) SetScrollScale(c *State, scale [2]float32) error {
+	t.ScrollScale = scale
+	return writeTileLayerBuffer(c, t)
+}
+
+func (t *TileLayerNode) SetScrollOffset(c *State, offset [2]float32) error {
+	t.ScrollOffset = offset
+	return writeTileLayerBuffer(c, t)
+}
+
+// velocity is in pixels per second. Setting it resets the accumulated drift.
+func (t *TileLayerNode) SetScrollVelocity(c *State, velocity [2]float32) error {
+	t.ScrollVelocity = velocity
+	t.scrollDrift = [2]float32{}
+	t.lastRun = time.Time{}
+	return writeTileLayerBuffer(c, t)
+}
+
+func (t *TileLayerNode) SetTint(c *State, tint [4]float32) error {
+	t.Tint = tint
+	return writeTileLayerBuffer(c, t)
+}
+
+// 1 is fully opaque, 0 invisible. layers start out opaque. may be called before Init
+func (t *TileLayerNode) SetOpacity(c *State, opacity float32) error {
+	t.transparency = 1 - opacity
+	return writeTileLayerBuffer(c, t)
+}
+
+func (t *TileLayerNode) Opacity() float32 {
+	return 1 - t.transparency
+}
+
+// the offset the shader scrolls by: ScrollOffset plus the accumulated ScrollVelocity drift
+func (t *TileLayerNode) scrollOffset() [2]float32 {
+	return [2]float32{t.ScrollOffset[0] + t.scrollDrift[0], t.ScrollOffset[1] + t.scrollDrift[1]}
+}
+
+func writeTileLayerBuffer(c *State, t *TileLayerNode) error {
+	if t.UniformBuffer == nil {
+		return nil
+	}
+
+	b := packTileLayerUniform(t.ScrollScale, t.scrollOffset(), t.Tint, t.transparency)
+
+	return c.Queue.WriteBuffer(t.UniformBuffer, 0, b)
+}
+
+// returns the view, format and size (in pixels) a node pass draws into.
+// if no framebuffer is provided, draw into the device's default frame texture
+func renderTarget(c *State, fb *FrameBufferNode, view *wgpu.TextureView) (*wgpu.TextureView, wgpu.TextureFormat, [2]int) {
+	if fb != nil {
+		return fb.Material.View, fb.Format, [2]int{fb.Material.Size.Width, fb.Material.Size.Height}
+	}
+	return view, c.Config.Format, [2]int{int(c.Config.Width), int(c.Config.Height)}
+}
+
+// tile layers historically always loaded, so keep that as the default
+func tileLoadOp(op wgpu.LoadOp) wgpu.LoadOp {
+	if op == wgpu.LoadOpUndefined {
+		return wgpu.LoadOpLoad
+	}
+	return op
+}
+
+// shared by every node that draws with the tile atlas pipeline. the shader multiplies by opacity, the nodes keep
+// transparency so their zero value is opaque
+func packTileLayerUniform(scrollScale [2]float32, scrollOffset [2]float32, tint [4]float32, transparency float32) []byte {
+	b := make([]byte, TILE_LAYER_UNIFORM_SIZE)
+
+	putF32(b, OFF_LAYER_SCROLL_SCALE+0, scrollScale[0])
+	putF32(b, OFF_LAYER_SCROLL_SCALE+4, scrollScale[1])
+
+	putF32(b, OFF_LAYER_SCROLL_OFFSET+0, scrollOffset[0])
+	putF32(b, OFF_LAYER_SCROLL_OFFSET+4, scrollOffset[1])
+
+	putF32(b, OFF_LAYER_TINT+0, tint[0])
+	putF32(b, OFF_LAYER_TINT+4, tint[1])
+	putF32(b, OFF_LAYER_TINT+8, tint[2])
+	putF32(b, OFF_LAYER_TINT+12, tint[3])
+
+	putF32(b, OFF_LAYER_OPACITY, 1-transparency)
+
+	return b
+}
@@ -0,0 +1,36 @@
+package cobalt
+
+import (
+	"image"
+	"testing"
+)
+
+func TestTileLayerCheckOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(c *State, l *TileLayerNode) error
+		saved bool
+	}{
+		{"loaded from texturePath", func(c *State, l *TileLayerNode) error { return nil }, true},
+		{"SetTile", func(c *State, l *TileLayerNode) error { return l.SetTile(c, 1, 1, [2]int{3, 0}) }, false},
+		{"ClearTile", func(c *State, l *TileLayerNode) error { return l.ClearTile(c, 0, 0) }, false},
+		{"out of bounds edits change nothing", func(c *State, l *TileLayerNode) error {
+			if l.SetTile(c, 9, 9, [2]int{}) == nil {
+				t.Error("SetTile outside of the layer succeeded")
+			}
+			return nil
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &TileLayerNode{TexturePath: "map.png", Cells: image.NewRGBA(image.Rect(0, 0, 4, 4))}
+			if err := tt.edit(&State{}, l); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.CheckOptions(); (err == nil) != tt.saved {
+				t.Errorf("CheckOptions() = %v, want saveable %v", err, tt.saved)
+			}
+		})
+	}
+}
@@ -6,12 +6,15 @@ struct TransformData {
     inverseTileSize: f32,
 };
 
-struct TileScroll {
-    scrollScale: vec2<f32>
+struct TileLayer {
+    scrollScale: vec2<f32>,
+    scrollOffset: vec2<f32>,
+    tint: vec4<f32>,
+    opacity: f32,
 };
 
 // individual tile texture
-@binding(0) @group(0) var<uniform> myScroll: TileScroll;
+@binding(0) @group(0) var<uniform> myLayer: TileLayer;
 @binding(1) @group(0) var tileTexture: texture_2d<f32>;
 @binding(2) @group(0) var tileSampler: sampler;
 
@@ -64,9 +67,9 @@ fn vs_main (@builtin(instance_index) i_id : u32,
 
     let inverseTileTextureSize = 1 / vec2<f32>(textureDimensions(tileTexture, 0));  // transformUBO.tileLayers[i_id].inverseTileTextureSize;
 
-    var scrollScale = myScroll.scrollScale; //transformUBO.tileLayers[i_id].scrollScale;
+    var scrollScale = myLayer.scrollScale; //transformUBO.tileLayers[i_id].scrollScale;
 
-    var viewOffset : vec2<f32> = transformUBO.viewOffset * scrollScale;
+    var viewOffset : vec2<f32> = transformUBO.viewOffset * scrollScale + myLayer.scrollOffset;
 
 
     // from Brandon's webgl-tile shader
@@ -106,6 +109,8 @@ fn fs_main (@location(0) TexCoord: vec2<f32>) -> @location(0) vec4<f32> {
     if (color.a <= 0.1) {
         discard;
     }
-    return color;
+
+    let tint = myLayer.tint;
+    return vec4<f32>(color.rgb * (1.0 - tint.a) + (tint.rgb * tint.a), color.a * myLayer.opacity);
 }
 
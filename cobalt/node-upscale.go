@@ -0,0 +1,368 @@
+package cobalt
+
+import (
+	_ "embed"
+	"errors"
+	"image"
+	"math"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Pixel perfect output for low resolution games. The game renders at a fixed resolution into a framebuffer (the
+viewport dimensions, e.g. SetViewportDimensions(c, 480, 270)) and the upscale node draws it to the window, centered,
+with bars filling the rest:
+
+	fb -> [tile layers, sprites with "target": "fb"] -> upscale ("source": "fb") -> window
+
+UpscaleInteger uses the largest whole scale factor that fits, so every game pixel is the same size on screen.
+UpscaleSharpBilinear fills as much of the window as the aspect ratio allows, blending only along texel edges so the
+result stays sharp at any scale.
+*/
+
+//go:embed node-upscale.wgsl
+var upscaleWGSL string
+
+type UpscaleMode int
+
+const (
+	UpscaleInteger       UpscaleMode = iota // largest integer scale, letterboxed
+	UpscaleSharpBilinear                    // fit the window, sharp bilinear filtering for non-integer scales
+)
+
+type UpscaleNode struct {
+	SourceFb *FrameBufferNode
+	Mode     UpscaleMode
+	BarColor wgpu.Color // letterbox/pillarbox color
+
+	BindGroupLayout *wgpu.BindGroupLayout
+	BindGroup       *wgpu.BindGroup
+	Pipeline        *wgpu.RenderPipeline
+	UniformBuffer   *wgpu.Buffer
+
+	pipelineLayout *wgpu.PipelineLayout
+	sampler        *wgpu.Sampler
+
+	disabled bool // see SetEnabled
+}
+
+func newUpscaleNode(c *State, options map[string]any) (NodeDefinition, error) {
+	r := readOptions("cobalt:upscale", options)
+	t := &UpscaleNode{BarColor: r.color("barColor", wgpu.Color{A: 1})}
+
+	switch mode := r.string("mode", "integer"); mode {
+	case "integer":
+		t.Mode = UpscaleInteger
+	case "sharpBilinear":
+		t.Mode = UpscaleSharpBilinear
+	default:
+		r.fail("mode", `"integer" or "sharpBilinear"`, mode)
+	}
+
+	return t, r.done()
+}
+
+func (t *UpscaleNode) Options() map[string]any {
+	mode := "integer"
+	if t.Mode == UpscaleSharpBilinear {
+		mode = "sharpBilinear"
+	}
+	return map[string]any{
+		"mode":     mode,
+		"barColor": colorOption(t.BarColor),
+	}
+}
+
+func (t *UpscaleNode) Init(c *State) error {
+	if t.SourceFb == nil {
+		return errors.New("upscale node needs a SourceFb")
+	}
+
+	bindGroupLayout, err := c.Device.CreateBindGroupLayout(&wgpu.BindGroupLayoutDescriptor{
+		Entries: []wgpu.BindGroupLayoutEntry{
+			{
+				Binding:    0,
+				Visibility: wgpu.ShaderStageFragment,
+				Texture: wgpu.TextureBindingLayout{
+					SampleType:    wgpu.TextureSampleTypeFloat,
+					ViewDimension: wgpu.TextureViewDimension2D,
+				},
+			},
+			{
+				Binding:    1,
+				Visibility: wgpu.ShaderStageFragment,
+				Sampler: wgpu.SamplerBindingLayout{
+					Type: wgpu.SamplerBindingTypeFiltering,
+				},
+			},
+			{
+				Binding:    2,
+				Visibility: wgpu.ShaderStageFragment,
+				Buffer: wgpu.BufferBindingLayout{
+					Type: wgpu.BufferBindingTypeUniform,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	t.BindGroupLayout = bindGroupLayout
+
+	// sharp bilinear relies on linear filtering. the framebuffer's own sampler is nearest
+	sampler, err := c.Device.CreateSampler(&wgpu.SamplerDescriptor{
+		AddressModeU:  wgpu.AddressModeClampToEdge,
+		AddressModeV:  wgpu.AddressModeClampToEdge,
+		AddressModeW:  wgpu.AddressModeClampToEdge,
+		MagFilter:     wgpu.FilterModeLinear,
+		MinFilter:     wgpu.FilterModeLinear,
+		MipmapFilter:  wgpu.MipmapFilterModeNearest,
+		LodMaxClamp:   32,
+		MaxAnisotropy: 1,
+	})
+	if err != nil {
+		return err
+	}
+	t.sampler = sampler
+
+	uniformBuffer, err := createBufferInit(c, t, &wgpu.BufferInitDescriptor{
+		Label:    "upscale uniform",
+		Contents: make([]byte, 16),
+		Usage:    wgpu.BufferUsageUniform | wgpu.BufferUsageCopyDst,
+	})
+	if err != nil {
+		return err
+	}
+	t.UniformBuffer = uniformBuffer
+
+	if err := t.buildBindGroup(c); err != nil {
+		return err
+	}
+
+	pipelineLayout, err := c.Device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
+		BindGroupLayouts: []*wgpu.BindGroupLayout{bindGroupLayout},
+	})
+	if err != nil {
+		return err
+	}
+	t.pipelineLayout = pipelineLayout
+
+	return t.buildPipeline(c)
+}
+
+// the bind group points at the framebuffer texture, which is replaced on every resize
+func (t *UpscaleNode) buildBindGroup(c *State) error {
+	bindGroup, err := createBindGroup(c, t, &wgpu.BindGroupDescriptor{
+		Layout: t.BindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{
+				Binding:     0,
+				TextureView: t.SourceFb.Material.View,
+			},
+			{
+				Binding: 1,
+				Sampler: t.sampler,
+			},
+			{
+				Binding: 2,
+				Buffer:  t.UniformBuffer,
+				Size:    wgpu.WholeSize,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	releaseBindGroup(c, t.BindGroup)
+	t.BindGroup = bindGroup
+	return nil
+}
+
+// (re)compile the upscale shader and pipeline. on failure the previous pipeline is kept
+func (t *UpscaleNode) buildPipeline(c *State) error {
+	shader, err := c.Device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
+		Label: "node-upscale.wgsl",
+		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{
+			Code: shaderSource(c, "node-upscale.wgsl", upscaleWGSL),
+		},
+	})
+	if err != nil {
+		logger(c).Error("shader compilation failed", "shader", "node-upscale.wgsl", "err", err)
+		return err
+	}
+	defer shader.Release()
+
+	pipeline, err := c.Device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
+		Label:  "upscale",
+		Layout: t.pipelineLayout,
+		Vertex: wgpu.VertexState{
+			Module:     shader,
+			EntryPoint: "vs_main",
+		},
+		Fragment: &wgpu.FragmentState{
+			Module:     shader,
+			EntryPoint: "fs_main",
+			Targets: []wgpu.ColorTargetState{
+				{
+					Format:    c.Config.Format,
+					WriteMask: wgpu.ColorWriteMaskAll,
+				},
+			},
+		},
+		Primitive: wgpu.PrimitiveState{
+			Topology:  wgpu.PrimitiveTopologyTriangleList,
+			CullMode:  wgpu.CullModeNone,
+			FrontFace: wgpu.FrontFaceCCW,
+		},
+		Multisample: wgpu.MultisampleState{
+			Count: 1,
+			Mask:  0xFFFFFFFF,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+	}
+	t.Pipeline = pipeline
+
+	return nil
+}
+
+func (t *UpscaleNode) WatchedFiles(c *State) []string {
+	return watchList(shaderOverride(c, "node-upscale.wgsl"))
+}
+
+func (t *UpscaleNode) Reload(c *State, path string) error {
+	return t.buildPipeline(c)
+}
+
+func (t *UpscaleNode) OnSurfaceFormat(c *State) error {
+	return t.buildPipeline(c)
+}
+
+func (t *UpscaleNode) GetType() string {
+	return "cobalt:upscale"
+}
+
+func (t *UpscaleNode) IsEnabled() bool {
+	return !t.disabled
+}
+
+func (t *UpscaleNode) SetEnabled(c *State, enabled bool) error {
+	return toggleNode(c, t, &t.disabled, enabled)
+}
+
+// where the game image lands in the window, in surface pixels. the rest is covered by bars
+func (t *UpscaleNode) Rect(c *State) image.Rectangle {
+	src := [2]float64{float64(t.SourceFb.Material.Size.Width), float64(t.SourceFb.Material.Size.Height)}
+	dst := [2]float64{float64(c.Config.Width), float64(c.Config.Height)}
+
+	scale := t.scale(src, dst)
+	w := math.Round(src[0] * scale)
+	h := math.Round(src[1] * scale)
+	x := math.Floor((dst[0] - w) / 2)
+	y := math.Floor((dst[1] - h) / 2)
+
+	return image.Rect(int(x), int(y), int(x+w), int(y+h))
+}
+
+// output pixels per game pixel
+func (t *UpscaleNode) scale(src [2]float64, dst [2]float64) float64 {
+	fit := math.Min(dst[0]/src[0], dst[1]/src[1])
+
+	// a window smaller than the game can't fit an integer scale, so it's shrunk to fit
+	if t.Mode == UpscaleInteger && fit >= 1 {
+		return math.Floor(fit)
+	}
+	return fit
+}
+
+// view is the backing frame texture view that is created each frame
+func (t *UpscaleNode) OnRun(c *State, encoder *wgpu.CommandEncoder, view *wgpu.TextureView) error {
+	r := t.Rect(c)
+	if r.Empty() {
+		return nil
+	}
+
+	// scales below 1 are uploaded as 1, which turns fs_main into plain bilinear filtering
+	size := t.SourceFb.Material.Size
+	uniform := make([]byte, 16)
+	putF32(uniform, 0, max(float32(r.Dx())/float32(size.Width), 1))
+	putF32(uniform, 4, max(float32(r.Dy())/float32(size.Height), 1))
+	if err := c.Queue.WriteBuffer(t.UniformBuffer, 0, uniform); err != nil {
+		return err
+	}
+
+	// clearing paints the bars, the game image is drawn over the rest
+	renderPass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
+		Label: "upscale renderpass",
+		ColorAttachments: []wgpu.RenderPassColorAttachment{
+			{
+				View:       view,
+				ClearValue: t.BarColor,
+				LoadOp:     wgpu.LoadOpClear,
+				StoreOp:    wgpu.StoreOpStore,
+			},
+		},
+	})
+	defer renderPass.Release()
+
+	renderPass.SetViewport(float32(r.Min.X), float32(r.Min.Y), float32(r.Dx()), float32(r.Dy()), 0, 1)
+	renderPass.SetPipeline(t.Pipeline)
+	renderPass.SetBindGroup(0, t.BindGroup, nil)
+	renderPass.Draw(3, 1, 0, 0) // fullscreen triangle, clipped to the viewport
+
+	return renderPass.End()
+}
+
+func (t *UpscaleNode) OnDestroy(c *State) error {
+	releaseBindGroup(c, t.BindGroup)
+	releaseBuffer(c, t.UniformBuffer)
+	t.BindGroup, t.UniformBuffer = nil, nil
+
+	if t.Pipeline != nil {
+		t.Pipeline.Release()
+		t.Pipeline = nil
+	}
+	if t.pipelineLayout != nil {
+		t.pipelineLayout.Release()
+		t.pipelineLayout = nil
+	}
+	if t.BindGroupLayout != nil {
+		t.BindGroupLayout.Release()
+		t.BindGroupLayout = nil
+	}
+	if t.sampler != nil {
+		t.sampler.Release()
+		t.sampler = nil
+	}
+
+	return nil
+}
+
+func (t *UpscaleNode) OnViewportPosition(c *State) error {
+	return nil
+}
+
+func (t *UpscaleNode) OnResize(c *State) error {
+	return t.buildBindGroup(c)
+}
+
+func (t *UpscaleNode) SetRef(name string, node NodeDefinition) error {
+	switch name {
+	case "source":
+		fb, ok := node.(*FrameBufferNode)
+		if !ok {
+			return refTypeError(t, name, node)
+		}
+		t.SourceFb = fb
+	default:
+		return unknownRefError(t, name)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+struct Upscale {
+    scale: vec2<f32>, // output pixels per source texel
+};
+
+@binding(0) @group(0) var sourceTexture: texture_2d<f32>;
+@binding(1) @group(0) var sourceSampler: sampler;
+@binding(2) @group(0) var<uniform> upscale: Upscale;
+
+
+struct Fragment {
+    @builtin(position) Position : vec4<f32>,
+    @location(0) TexCoord : vec2<f32>
+};
+
+// fullscreen triangle position and uvs
+fn fullscreen_pos(i: u32) -> vec2<f32> {
+  var p: vec2<f32>;
+
+  // 3-vertex fullscreen triangle
+  switch i {
+    case 0u: { p = vec2<f32>(-1.0, -3.0); }
+    case 1u: { p = vec2<f32>(3.0,  1.0); }
+    default: { p = vec2<f32>(-1.0,  1.0); }
+  }
+    return p;
+}
+
+
+fn fullscreen_uv(i: u32) -> vec2<f32> {
+    var p: vec2<f32>;
+
+  // 3-vertex fullscreen triangle
+  switch i {
+    case 0u: { p = vec2<f32>(0.0, 2.0); }
+    case 1u: { p = vec2<f32>(2.0,  0.0); }
+    default: { p = vec2<f32>(0.0,  0.0); }
+  }
+    return p;
+}
+
+
+@vertex
+fn vs_main (@builtin(vertex_index) VertexIndex : u32) -> Fragment  {
+
+    var output : Fragment;
+
+    output.Position = vec4<f32>(fullscreen_pos(VertexIndex), 0.0, 1.0);
+    output.TexCoord = vec2<f32>(fullscreen_uv(VertexIndex));
+
+    return output;
+}
+
+
+// sharp bilinear: sample texel centers like nearest filtering, and only blend across the last output pixel at
+// each texel edge. at integer scales this is exactly nearest filtering.
+@fragment
+fn fs_main (@location(0) TexCoord: vec2<f32>) -> @location(0) vec4<f32> {
+    let size = vec2<f32>(textureDimensions(sourceTexture, 0));
+    let texel = TexCoord * size;
+
+    let regionRange = 0.5 - 0.5 / upscale.scale;
+    let centerDist = fract(texel) - 0.5;
+    let f = (centerDist - clamp(centerDist, -regionRange, regionRange)) * upscale.scale + 0.5;
+
+    let col = textureSample(sourceTexture, sourceSampler, (floor(texel) + f) / size);
+    return vec4<f32>(col.rgb, 1.0);
+}
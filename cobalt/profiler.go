@@ -0,0 +1,452 @@
+package cobalt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Per-node frame timings, for finding out which part of the graph eats the frame:
+
+	cobalt.EnableProfiling(c, cobalt.ProfileOptions{})
+	...
+	fmt.Print(cobalt.ProfileReport(c))
+
+Init requests the TimestampQuery feature when the adapter has it. Profiling then writes GPU timestamps with the
+command encoder's WriteTimestamp before and after each node's OnRun, so a node's time covers the GPU work of the
+passes it recorded. Render pass timestampWrites aren't used: the binding doesn't expose them. The timestamps are
+read back a couple of frames later, without stalling the queue.
+
+Encoder timestamps are an optional part of the feature, and backends that only allow timestamps at pass
+boundaries reject them. Without the feature, or when WriteTimestamp is rejected, profiling falls back to
+measuring the CPU time each OnRun takes to record its commands; Profile.GPU says which kind a report holds.
+
+A node that runs more than once per frame (once per view, see AddView) is reported with the sum of its runs.
+ProfilerOverlayNode draws the report over the frame.
+*/
+
+const (
+	profileQueries   = 512 // timestamps per frame, two per node run
+	profileReadbacks = 3   // frames in flight before GPU timing skips a frame
+)
+
+type ProfileOptions struct {
+	// measure CPU time even when GPU timestamps are available
+	CPUOnly bool
+
+	// nanoseconds per GPU timestamp tick. defaults to 1, which is what most desktop drivers use. the binding
+	// doesn't expose the queue's timestamp period, so set it for GPUs that tick differently
+	TimestampPeriod float64
+
+	// frames the averages cover. defaults to 120
+	Frames int
+}
+
+type NodeTiming struct {
+	Node    NodeDefinition
+	Name    string // graph name, when the node was declared with InitNode
+	Average time.Duration
+	Max     time.Duration
+	Last    time.Duration // most recent measured frame
+}
+
+type Profile struct {
+	GPU    bool          // GPU timestamps. false means CPU time spent in OnRun
+	Frames int           // frames measured, up to ProfileOptions.Frames
+	Total  time.Duration // sum of the node averages
+	Nodes  []NodeTiming  // in render order
+}
+
+type profiler struct {
+	opts ProfileOptions
+	gpu  bool
+
+	querySet  *wgpu.QuerySet
+	resolve   *wgpu.Buffer
+	readbacks [profileReadbacks]*profileReadback
+
+	current *profileReadback // where this frame's timestamps go. nil when every readback is still in flight
+	queries uint32           // timestamps written this frame
+
+	cpu     map[NodeDefinition]time.Duration // this frame's OnRun times, when measuring CPU time
+	partial bool                             // fell back to CPU time part way through this frame
+	history []map[NodeDefinition]time.Duration
+	next    int // oldest entry of history once it's full
+	latest  map[NodeDefinition]time.Duration
+}
+
+// a frame's timestamps on their way back from the GPU
+type profileReadback struct {
+	buffer  *wgpu.Buffer
+	spans   []profileSpan
+	count   uint32 // timestamps copied
+	pending bool   // waiting for MapAsync
+	done    bool   // the map callback ran
+	ok      bool
+}
+
+type profileSpan struct {
+	node  NodeDefinition
+	query uint32 // the timestamp before OnRun, query+1 is the one after
+}
+
+func EnableProfiling(c *State, opts ProfileOptions) {
+	DisableProfiling(c)
+
+	if opts.TimestampPeriod <= 0 {
+		opts.TimestampPeriod = 1
+	}
+	if opts.Frames <= 0 {
+		opts.Frames = 120
+	}
+
+	p := &profiler{opts: opts, cpu: make(map[NodeDefinition]time.Duration)}
+	if !opts.CPUOnly && c.Device.HasFeature(wgpu.FeatureNameTimestampQuery) {
+		if err := p.createQueries(c); err != nil {
+			logger(c).Warn("encoder WriteTimestamp unsupported on this backend, profiling cpu time instead", "err", err)
+			p.releaseQueries(c)
+		} else {
+			p.gpu = true
+		}
+	}
+
+	source := "cpu time in OnRun"
+	if p.gpu {
+		source = "gpu timestamps from encoder WriteTimestamp (not render pass timestampWrites)"
+	}
+	logger(c).Debug("profiling enabled", "gpu", p.gpu, "source", source)
+	c.profiler = p
+}
+
+func DisableProfiling(c *State) {
+	if c.profiler == nil {
+		return
+	}
+	c.profiler.releaseQueries(c)
+	c.profiler = nil
+}
+
+// per-node timings over the last ProfileOptions.Frames frames. empty when profiling is off
+func ProfileReport(c *State) Profile {
+	p := c.profiler
+	if p == nil {
+		return Profile{}
+	}
+
+	r := Profile{GPU: p.gpu, Frames: len(p.history)}
+	for _, n := range c.Nodes {
+		var t NodeTiming
+		var total time.Duration
+		runs := 0
+		for _, frame := range p.history {
+			d, ok := frame[n]
+			if !ok {
+				continue
+			}
+			total += d
+			runs++
+			t.Max = max(t.Max, d)
+		}
+		if runs == 0 {
+			continue
+		}
+
+		t.Node = n
+		t.Name = nodeName(c, n)
+		t.Average = total / time.Duration(runs)
+		t.Last = p.latest[n]
+
+		r.Total += t.Average
+		r.Nodes = append(r.Nodes, t)
+	}
+	return r
+}
+
+func (r Profile) String() string {
+	source := "cpu"
+	if r.GPU {
+		source = "gpu"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s time per node over %d frames\n", source, r.Frames)
+	for _, t := range r.Nodes {
+		name := t.Node.GetType()
+		if t.Name != "" {
+			name += fmt.Sprintf(" %q", t.Name)
+		}
+		fmt.Fprintf(&b, "  %-40s avg %9s  max %9s\n", name, milliseconds(t.Average), milliseconds(t.Max))
+	}
+	fmt.Fprintf(&b, "  %-40s avg %9s\n", "total", milliseconds(r.Total))
+	return b.String()
+}
+
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
+
+func (p *profiler) createQueries(c *State) error {
+	querySet, err := c.Device.CreateQuerySet(&wgpu.QuerySetDescriptor{
+		Label: "profiler",
+		Type:  wgpu.QueryTypeTimestamp,
+		Count: profileQueries,
+	})
+	if err != nil {
+		return err
+	}
+	p.querySet = querySet
+
+	p.resolve, err = c.Device.CreateBuffer(&wgpu.BufferDescriptor{
+		Label: "profiler resolve",
+		Usage: wgpu.BufferUsageQueryResolve | wgpu.BufferUsageCopySrc,
+		Size:  profileQueries * 8,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range p.readbacks {
+		buffer, err := c.Device.CreateBuffer(&wgpu.BufferDescriptor{
+			Label: "profiler readback",
+			Usage: wgpu.BufferUsageMapRead | wgpu.BufferUsageCopyDst,
+			Size:  profileQueries * 8,
+		})
+		if err != nil {
+			return err
+		}
+		p.readbacks[i] = &profileReadback{buffer: buffer}
+	}
+
+	return p.probe(c)
+}
+
+// some drivers only allow timestamps inside passes. a rejected timestamp invalidates the whole encoder, so
+// it's tried on a throwaway one before any frame depends on it
+func (p *profiler) probe(c *State) error {
+	encoder, err := c.Device.CreateCommandEncoder(nil)
+	if err != nil {
+		return err
+	}
+	defer encoder.Release()
+
+	if err := encoder.WriteTimestamp(p.querySet, 0); err != nil {
+		return err
+	}
+
+	cmdBuffer, err := encoder.Finish(nil)
+	if err != nil {
+		return err
+	}
+	cmdBuffer.Release()
+	return nil
+}
+
+func (p *profiler) releaseQueries(c *State) {
+	for i, rb := range p.readbacks {
+		if rb != nil {
+			releaseBuffer(c, rb.buffer)
+			p.readbacks[i] = nil
+		}
+	}
+	releaseBuffer(c, p.resolve)
+	p.resolve = nil
+
+	if p.querySet != nil {
+		p.querySet.Release()
+		p.querySet = nil
+	}
+	p.current = nil
+}
+
+// timestamps stopped working: measure CPU time from now on. nodes that ran earlier in the frame weren't timed
+// on the CPU, so the rest of this frame is dropped
+func (p *profiler) fallBack(c *State, err error) {
+	logger(c).Warn("encoder WriteTimestamp failed, profiling cpu time instead", "err", err)
+	p.releaseQueries(c)
+	p.gpu = false
+	p.history, p.next, p.latest = nil, 0, nil
+	clear(p.cpu)
+	p.partial = true
+}
+
+func (p *profiler) push(frame map[NodeDefinition]time.Duration) {
+	p.latest = frame
+	if len(p.history) < p.opts.Frames {
+		p.history = append(p.history, frame)
+		return
+	}
+	p.history[p.next] = frame
+	p.next = (p.next + 1) % len(p.history)
+}
+
+// called by Draw before the nodes run
+func beginProfile(c *State) {
+	p := c.profiler
+	if p == nil {
+		return
+	}
+
+	p.queries = 0
+	p.current = nil
+	p.partial = false
+	clear(p.cpu)
+	if !p.gpu {
+		return
+	}
+
+	// runs the map callbacks of finished readbacks
+	c.Device.Poll(false, nil)
+
+	for _, rb := range p.readbacks {
+		if rb.pending && rb.done {
+			p.collect(c, rb)
+		}
+	}
+	for _, rb := range p.readbacks {
+		if !rb.pending {
+			rb.spans = rb.spans[:0]
+			p.current = rb
+			break
+		}
+	}
+}
+
+// called by submitNodes before a node's OnRun. with GPU timing this writes a timestamp with the encoder's
+// WriteTimestamp (render pass timestampWrites aren't available), and a rejected timestamp switches profiling to CPU
+// time. the returned time is passed on to profileEnd
+func profileBegin(c *State, encoder *wgpu.CommandEncoder) time.Time {
+	p := c.profiler
+	if p == nil {
+		return time.Time{}
+	}
+
+	if p.gpu && p.current != nil && p.queries+2 <= profileQueries {
+		if err := encoder.WriteTimestamp(p.querySet, p.queries); err != nil {
+			p.fallBack(c, err)
+		}
+	}
+	return time.Now()
+}
+
+// called by submitNodes after a node's OnRun. writes the closing WriteTimestamp, or adds the OnRun's CPU time
+func profileEnd(c *State, encoder *wgpu.CommandEncoder, n NodeDefinition, start time.Time) {
+	p := c.profiler
+	if p == nil {
+		return
+	}
+
+	if !p.gpu {
+		p.cpu[n] += time.Since(start)
+		return
+	}
+	if p.current == nil || p.queries+2 > profileQueries {
+		return
+	}
+
+	if err := encoder.WriteTimestamp(p.querySet, p.queries+1); err != nil {
+		p.fallBack(c, err)
+		return
+	}
+	p.current.spans = append(p.current.spans, profileSpan{node: n, query: p.queries})
+	p.queries += 2
+}
+
+// called by Draw when the frame is done. submitted is false when the frame was abandoned; its timings are
+// dropped, and the timestamps it wrote are never resolved
+func endProfile(c *State, submitted bool) {
+	p := c.profiler
+	if p == nil {
+		return
+	}
+
+	if !submitted || p.partial {
+		if p.current != nil {
+			p.current.spans = p.current.spans[:0]
+		}
+		p.queries = 0
+		clear(p.cpu)
+		return
+	}
+
+	if !p.gpu {
+		if len(p.cpu) > 0 {
+			p.push(maps.Clone(p.cpu))
+		}
+		return
+	}
+
+	if p.current == nil || p.queries == 0 {
+		return
+	}
+	if err := p.readBack(c, p.current); err != nil {
+		p.fallBack(c, err)
+	}
+}
+
+// resolve the frame's timestamps and start mapping them. the queries were written by the frame's earlier
+// submits, so this goes in a command buffer of its own after them
+func (p *profiler) readBack(c *State, rb *profileReadback) error {
+	encoder, err := c.Device.CreateCommandEncoder(nil)
+	if err != nil {
+		return err
+	}
+	defer encoder.Release()
+
+	size := uint64(p.queries) * 8
+	if err := encoder.ResolveQuerySet(p.querySet, 0, p.queries, p.resolve, 0); err != nil {
+		return err
+	}
+	if err := encoder.CopyBufferToBuffer(p.resolve, 0, rb.buffer, 0, size); err != nil {
+		return err
+	}
+
+	cmdBuffer, err := encoder.Finish(nil)
+	if err != nil {
+		return err
+	}
+	defer cmdBuffer.Release()
+	c.Queue.Submit(cmdBuffer)
+
+	rb.count = p.queries
+	rb.pending, rb.done, rb.ok = true, false, false
+	err = rb.buffer.MapAsync(wgpu.MapModeRead, 0, size, func(status wgpu.BufferMapAsyncStatus) {
+		rb.done = true
+		rb.ok = status == wgpu.BufferMapAsyncStatusSuccess
+	})
+	if err != nil {
+		rb.pending = false
+	}
+	return err
+}
+
+// turn a mapped readback into a frame of node timings
+func (p *profiler) collect(c *State, rb *profileReadback) {
+	rb.pending = false
+	if !rb.ok {
+		logger(c).Warn("profiler readback failed, frame dropped")
+		return
+	}
+
+	data := rb.buffer.GetMappedRange(0, uint(rb.count)*8)
+	frame := make(map[NodeDefinition]time.Duration)
+	for _, s := range rb.spans {
+		begin := binary.LittleEndian.Uint64(data[s.query*8:])
+		end := binary.LittleEndian.Uint64(data[(s.query+1)*8:])
+
+		var d time.Duration
+		if end > begin {
+			d = time.Duration(float64(end-begin) * p.opts.TimestampPeriod)
+		}
+		frame[s.node] += d
+	}
+
+	if err := rb.buffer.Unmap(); err != nil {
+		logger(c).Warn("profiler readback unmap failed", "err", err)
+	}
+	p.push(frame)
+}
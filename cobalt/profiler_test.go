@@ -0,0 +1,327 @@
+package cobalt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testProfilerState(frames int, nodes ...NodeDefinition) *State {
+	c := &State{Nodes: nodes}
+	EnableProfiling(c, ProfileOptions{CPUOnly: true, Frames: frames})
+	return c
+}
+
+func TestProfileReportHistory(t *testing.T) {
+	ms := time.Millisecond
+	a, b := &BlitNode{}, &UpscaleNode{}
+
+	tests := []struct {
+		name   string
+		frames int // ProfileOptions.Frames
+		pushed []map[NodeDefinition]time.Duration
+		want   map[NodeDefinition]NodeTiming
+		count  int // Profile.Frames
+	}{
+		{
+			name:   "averages and max",
+			frames: 4,
+			pushed: []map[NodeDefinition]time.Duration{{a: 1 * ms}, {a: 2 * ms}, {a: 6 * ms}},
+			want:   map[NodeDefinition]NodeTiming{a: {Average: 3 * ms, Max: 6 * ms, Last: 6 * ms}},
+			count:  3,
+		},
+		{
+			name:   "wrap around keeps the newest frames",
+			frames: 3,
+			pushed: []map[NodeDefinition]time.Duration{{a: 1 * ms}, {a: 2 * ms}, {a: 3 * ms}, {a: 4 * ms}, {a: 5 * ms}},
+			want:   map[NodeDefinition]NodeTiming{a: {Average: 4 * ms, Max: 5 * ms, Last: 5 * ms}},
+			count:  3,
+		},
+		{
+			name:   "the max leaves with its frame",
+			frames: 3,
+			pushed: []map[NodeDefinition]time.Duration{{a: 9 * ms}, {a: 1 * ms}, {a: 2 * ms}, {a: 3 * ms}},
+			want:   map[NodeDefinition]NodeTiming{a: {Average: 2 * ms, Max: 3 * ms, Last: 3 * ms}},
+			count:  3,
+		},
+		{
+			name:   "nodes are averaged over the frames they ran in",
+			frames: 4,
+			pushed: []map[NodeDefinition]time.Duration{{a: 2 * ms, b: 4 * ms}, {a: 4 * ms}, {a: 6 * ms, b: 8 * ms}},
+			want: map[NodeDefinition]NodeTiming{
+				a: {Average: 4 * ms, Max: 6 * ms, Last: 6 * ms},
+				b: {Average: 6 * ms, Max: 8 * ms, Last: 8 * ms},
+			},
+			count: 3,
+		},
+		{
+			name:   "a node that wasn't in the latest frame",
+			frames: 4,
+			pushed: []map[NodeDefinition]time.Duration{{a: 2 * ms, b: 4 * ms}, {a: 4 * ms}},
+			want: map[NodeDefinition]NodeTiming{
+				a: {Average: 3 * ms, Max: 4 * ms, Last: 4 * ms},
+				b: {Average: 4 * ms, Max: 4 * ms},
+			},
+			count: 2,
+		},
+		{
+			name:   "nothing measured",
+			frames: 4,
+			want:   map[NodeDefinition]NodeTiming{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testProfilerState(tt.frames, a, b)
+			for _, f := range tt.pushed {
+				c.profiler.push(f)
+			}
+
+			r := ProfileReport(c)
+			if r.Frames != tt.count {
+				t.Errorf("Frames = %d, want %d", r.Frames, tt.count)
+			}
+			if len(r.Nodes) != len(tt.want) {
+				t.Fatalf("%d nodes in the report, want %d", len(r.Nodes), len(tt.want))
+			}
+
+			var total time.Duration
+			for _, got := range r.Nodes {
+				want, ok := tt.want[got.Node]
+				if !ok {
+					t.Errorf("unexpected node %s in the report", got.Node.GetType())
+					continue
+				}
+				if got.Average != want.Average || got.Max != want.Max || got.Last != want.Last {
+					t.Errorf("%s: avg %v max %v last %v, want %v %v %v", got.Node.GetType(),
+						got.Average, got.Max, got.Last, want.Average, want.Max, want.Last)
+				}
+				total += want.Average
+			}
+			if r.Total != total {
+				t.Errorf("Total = %v, want %v", r.Total, total)
+			}
+		})
+	}
+}
+
+func TestProfileReportOrderAndNames(t *testing.T) {
+	a, b := &BlitNode{}, &UpscaleNode{}
+	c := testProfilerState(4, b, a)
+	c.graphOrder = []*NodeInstance{{Name: "final", definition: b}}
+
+	c.profiler.push(map[NodeDefinition]time.Duration{a: time.Millisecond, b: 2 * time.Millisecond})
+
+	r := ProfileReport(c)
+	if len(r.Nodes) != 2 || r.Nodes[0].Node != b || r.Nodes[1].Node != a {
+		t.Fatalf("report isn't in render order: %+v", r.Nodes)
+	}
+	if r.Nodes[0].Name != "final" || r.Nodes[1].Name != "" {
+		t.Errorf("names = %q, %q, want the graph name and none", r.Nodes[0].Name, r.Nodes[1].Name)
+	}
+
+	s := r.String()
+	for _, want := range []string{"cpu time per node over 1 frames", `cobalt:upscale "final"`, "cobalt:blit", "total"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String() is missing %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestProfileSumsRunsAcrossViews(t *testing.T) {
+	ms := time.Millisecond
+	a, b := &BlitNode{}, &UpscaleNode{}
+	c := testProfilerState(4, a, b)
+
+	// a runs once per view, b once
+	beginProfile(c)
+	profileEnd(c, nil, a, time.Now().Add(-10*ms))
+	profileEnd(c, nil, a, time.Now().Add(-20*ms))
+	profileEnd(c, nil, b, time.Now().Add(-5*ms))
+	endProfile(c, true)
+
+	r := ProfileReport(c)
+	if len(r.Nodes) != 2 {
+		t.Fatalf("%d nodes in the report, want 2", len(r.Nodes))
+	}
+
+	// the measured times only run long, by however slow the test machine is
+	check := func(got NodeTiming, want time.Duration) {
+		if got.Average < want || got.Average > want+50*ms {
+			t.Errorf("%s: %v, want about %v", got.Node.GetType(), got.Average, want)
+		}
+	}
+	check(r.Nodes[0], 30*ms)
+	check(r.Nodes[1], 5*ms)
+}
+
+func TestProfileDropsAbandonedFrames(t *testing.T) {
+	a := &BlitNode{}
+	c := testProfilerState(4, a)
+
+	beginProfile(c)
+	profileEnd(c, nil, a, time.Now())
+	endProfile(c, false)
+
+	if r := ProfileReport(c); r.Frames != 0 || len(r.Nodes) != 0 {
+		t.Errorf("abandoned frame was recorded: %+v", r)
+	}
+
+	// the next frame starts clean
+	beginProfile(c)
+	profileEnd(c, nil, a, time.Now())
+	endProfile(c, true)
+
+	if r := ProfileReport(c); r.Frames != 1 {
+		t.Errorf("Frames = %d, want 1", r.Frames)
+	}
+}
+
+func TestProfileFallBackMidFrame(t *testing.T) {
+	a, b := &BlitNode{}, &UpscaleNode{}
+	c := testProfilerState(4, a, b)
+	p := c.profiler
+
+	// gpu timing with a node already timed this frame when the timestamps fail
+	c.profiler.push(map[NodeDefinition]time.Duration{a: time.Millisecond})
+	p.gpu = true
+	p.cpu[a] = time.Millisecond
+
+	p.fallBack(c, errors.New("timestamps rejected"))
+	profileEnd(c, nil, b, time.Now())
+	endProfile(c, true)
+
+	if p.gpu {
+		t.Fatal("still profiling gpu time after falling back")
+	}
+	if r := ProfileReport(c); r.Frames != 0 || r.GPU {
+		t.Errorf("report after falling back = %+v, want no frames of cpu time", r)
+	}
+
+	beginProfile(c)
+	profileEnd(c, nil, a, time.Now())
+	profileEnd(c, nil, b, time.Now())
+	endProfile(c, true)
+
+	if r := ProfileReport(c); r.Frames != 1 || len(r.Nodes) != 2 {
+		t.Errorf("report for the first full cpu frame = %+v, want both nodes over 1 frame", r)
+	}
+}
+
+func TestProfilerOverlayLayout(t *testing.T) {
+	ms := time.Millisecond
+
+	report := func(n int, avg, max time.Duration) Profile {
+		r := Profile{}
+		for i := 0; i < n; i++ {
+			r.Nodes = append(r.Nodes, NodeTiming{Node: &BlitNode{}, Average: avg, Max: max})
+			r.Total += avg
+		}
+		return r
+	}
+	width := func(r overlayRect) float32 { return r.bounds[2] - r.bounds[0] }
+
+	tests := []struct {
+		name    string
+		node    ProfilerOverlayNode
+		scale   [2]float32 // contentScale
+		report  Profile
+		rects   int
+		row     float32 // width of the first row's bar
+		tickX   float32 // center of the first row's max tick
+		budgetX float32 // center of the budget line
+	}{
+		{
+			name:    "budget defaults to a 60hz frame",
+			report:  report(1, time.Second/60, time.Second/60),
+			rects:   5,
+			row:     240,
+			tickX:   240,
+			budgetX: 240,
+		},
+		{
+			name:    "explicit budget and width",
+			node:    ProfilerOverlayNode{Budget: 10 * ms, Width: 100},
+			report:  report(2, 5*ms, 8*ms),
+			rects:   8,
+			row:     50,
+			tickX:   80,
+			budgetX: 100,
+		},
+		{
+			name:    "bars stop at one and a half budgets",
+			node:    ProfilerOverlayNode{Budget: 10 * ms, Width: 100},
+			report:  report(1, 30*ms, 40*ms),
+			rects:   5,
+			row:     150,
+			tickX:   150,
+			budgetX: 100,
+		},
+		{
+			name:    "content scale",
+			node:    ProfilerOverlayNode{Budget: 10 * ms, Width: 100},
+			scale:   [2]float32{2, 2},
+			report:  report(1, 5*ms, 5*ms),
+			rects:   5,
+			row:     100,
+			tickX:   100,
+			budgetX: 200,
+		},
+		{
+			name:    "rows are cut off at overlayRects",
+			node:    ProfilerOverlayNode{Budget: 10 * ms, Width: 100},
+			report:  report(400, 1*ms, 1*ms),
+			rects:   3*(overlayRects/3-3) + 2,
+			row:     10,
+			tickX:   10,
+			budgetX: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &State{contentScale: tt.scale}
+			rects := tt.node.layout(c, tt.report)
+
+			if len(rects) != tt.rects {
+				t.Fatalf("%d rects, want %d", len(rects), tt.rects)
+			}
+			if len(rects) > overlayRects {
+				t.Fatalf("%d rects don't fit the %d rect instance buffer", len(rects), overlayRects)
+			}
+
+			// background, stacked bar per row, then a bar and a tick per row, then the budget line
+			rows := (len(rects) - 2) / 3
+			bar, tick, budget := rects[1+rows], rects[2+rows], rects[len(rects)-1]
+
+			if w := width(bar); !near(float64(w), float64(tt.row), 1e-3) {
+				t.Errorf("row bar width = %v, want %v", w, tt.row)
+			}
+			if x := (tick.bounds[0] + tick.bounds[2]) / 2; !near(float64(x), float64(tt.tickX), 1e-3) {
+				t.Errorf("max tick at %v, want %v", x, tt.tickX)
+			}
+			if x := (budget.bounds[0] + budget.bounds[2]) / 2; !near(float64(x), float64(tt.budgetX), 1e-3) {
+				t.Errorf("budget line at %v, want %v", x, tt.budgetX)
+			}
+
+			// the stacked bar never runs past the cut off
+			var stacked float32
+			for _, r := range rects[1 : 1+rows] {
+				stacked += width(r)
+			}
+			limit := 1.5 * (budget.bounds[0] + budget.bounds[2]) / 2
+			if stacked > limit+1e-3 {
+				t.Errorf("stacked bar is %v wide, past the %v cut off", stacked, limit)
+			}
+		})
+	}
+}
+
+func TestProfilerOverlayEmptyReport(t *testing.T) {
+	n := &ProfilerOverlayNode{}
+	if rects := n.layout(&State{}, Profile{}); rects != nil {
+		t.Errorf("layout of an empty report = %d rects, want none", len(rects))
+	}
+}
@@ -0,0 +1,203 @@
+package cobalt
+
+import (
+	"fmt"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+GPU resources created by the built-in nodes are counted per node, so a destroy path that forgets something shows up
+as a leak when `Reset` runs instead of silently growing GPU memory. Nodes create buffers and bind groups through
+createBufferInit/createBindGroup, claim textures with ownTexture, and free them with releaseBuffer, releaseBindGroup
+and Texture.Release.
+*/
+
+type ResourceKind int
+
+const (
+	ResourceBuffer ResourceKind = iota
+	ResourceTexture
+	ResourceBindGroup
+)
+
+func (k ResourceKind) String() string {
+	switch k {
+	case ResourceBuffer:
+		return "buffer"
+	case ResourceTexture:
+		return "texture"
+	case ResourceBindGroup:
+		return "bind group"
+	}
+	return "unknown"
+}
+
+// live resources owned by one node
+type ResourceCount struct {
+	Node       NodeDefinition // nil for textures created outside of a node (e.g. CreateTexture called directly)
+	Name       string         // graph name, when the node was declared with InitNode
+	Buffers    int
+	Textures   int
+	BindGroups int
+}
+
+func (r ResourceCount) Total() int {
+	return r.Buffers + r.Textures + r.BindGroups
+}
+
+type trackedResource struct {
+	owner NodeDefinition
+	kind  ResourceKind
+}
+
+type resourceTracker struct {
+	live map[any]trackedResource
+}
+
+func (r *resourceTracker) add(owner NodeDefinition, kind ResourceKind, res any) {
+	if r.live == nil {
+		r.live = make(map[any]trackedResource)
+	}
+	r.live[res] = trackedResource{owner: owner, kind: kind}
+}
+
+func (r *resourceTracker) remove(res any) {
+	delete(r.live, res)
+}
+
+// live resource counts per owning node, in render order. owners that are no longer in c.Nodes come last
+func LiveResources(c *State) []ResourceCount {
+	counts := make(map[NodeDefinition]*ResourceCount)
+	var order []NodeDefinition
+
+	for _, res := range c.resources.live {
+		rc := counts[res.owner]
+		if rc == nil {
+			rc = &ResourceCount{Node: res.owner}
+			if res.owner != nil {
+				rc.Name = nodeName(c, res.owner)
+			}
+			counts[res.owner] = rc
+		}
+		switch res.kind {
+		case ResourceBuffer:
+			rc.Buffers++
+		case ResourceTexture:
+			rc.Textures++
+		case ResourceBindGroup:
+			rc.BindGroups++
+		}
+	}
+
+	for _, n := range c.Nodes {
+		if counts[n] != nil {
+			order = append(order, n)
+		}
+	}
+	for owner := range counts {
+		if !containsNode(order, owner) {
+			order = append(order, owner)
+		}
+	}
+
+	out := make([]ResourceCount, len(order))
+	for i, n := range order {
+		out[i] = *counts[n]
+	}
+	return out
+}
+
+// print every resource still alive after the nodes were destroyed
+func reportLeaks(c *State) {
+	for _, rc := range LiveResources(c) {
+		owner := "no node"
+		if rc.Node != nil {
+			owner = rc.Node.GetType()
+			if rc.Name != "" {
+				owner += fmt.Sprintf(" %q", rc.Name)
+			}
+		}
+		loudLogger(c).Warn("leaked gpu resources", "owner", owner, "buffers", rc.Buffers, "textures", rc.Textures, "bindGroups", rc.BindGroups)
+	}
+	c.resources.live = nil
+}
+
+func containsNode(nodes []NodeDefinition, n NodeDefinition) bool {
+	for _, o := range nodes {
+		if o == n {
+			return true
+		}
+	}
+	return false
+}
+
+func createBufferInit(c *State, owner NodeDefinition, desc *wgpu.BufferInitDescriptor) (*wgpu.Buffer, error) {
+	b, err := c.Device.CreateBufferInit(desc)
+	if err != nil {
+		return nil, err
+	}
+	c.resources.add(owner, ResourceBuffer, b)
+	return b, nil
+}
+
+func createBindGroup(c *State, owner NodeDefinition, desc *wgpu.BindGroupDescriptor) (*wgpu.BindGroup, error) {
+	bg, err := c.Device.CreateBindGroup(desc)
+	if err != nil {
+		return nil, err
+	}
+	c.resources.add(owner, ResourceBindGroup, bg)
+	return bg, nil
+}
+
+// attribute a texture to the node that keeps it
+func ownTexture(c *State, owner NodeDefinition, t *Texture) {
+	c.resources.add(owner, ResourceTexture, t)
+}
+
+func releaseBuffer(c *State, b *wgpu.Buffer) {
+	if b == nil {
+		return
+	}
+	c.resources.remove(b)
+	b.Destroy()
+	b.Release()
+}
+
+func releaseBindGroup(c *State, bg *wgpu.BindGroup) {
+	if bg == nil {
+		return
+	}
+	c.resources.remove(bg)
+	bg.Release()
+}
+
+// frees the mip views, view, sampler and texture. safe to call more than once
+func (t *Texture) Release() {
+	if t == nil {
+		return
+	}
+	for i := range t.MipView {
+		t.MipView[i].Release()
+	}
+	t.MipView = nil
+
+	if t.View != nil {
+		t.View.Release()
+		t.View = nil
+	}
+	if t.Sampler != nil {
+		t.Sampler.Release()
+		t.Sampler = nil
+	}
+	if t.Texture != nil {
+		t.Texture.Destroy()
+		t.Texture.Release()
+		t.Texture = nil
+	}
+
+	if t.tracker != nil {
+		t.tracker.remove(t)
+		t.tracker = nil
+	}
+}
@@ -0,0 +1,267 @@
+package cobalt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Scene files describe a whole render graph, so layer stacks can be reconfigured without recompiling:
+
+	{
+	  "nodes": [
+	    { "name": "atlas", "type": "cobalt:tileAtlas", "options": { "texturePath": "assets/tileset.png", "tileSize": 16 } },
+	    { "name": "bg", "type": "cobalt:tile", "options": { "texturePath": "assets/layer0.png", "scrollScale": [0.5, 0.5] }, "refs": { "tileAtlas": "atlas" } }
+	  ]
+	}
+
+Node types are looked up in the registry (see DefineNode), so third-party nodes work in scenes too.
+
+Scenes are JSON only: YAML would need a third party parser, and the module keeps its dependencies to webgpu and
+glfw. A YAML file can be converted to JSON before loading, the field names are the same.
+
+LoadSceneJSON is all or nothing: the scene is checked before any node is created, and when a node still fails to
+build or Init, the nodes declared so far are destroyed again.
+*/
+
+type Scene struct {
+	Nodes []SceneNode `json:"nodes"`
+}
+
+type SceneNode struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Options map[string]any    `json:"options,omitempty"`
+	Refs    map[string]string `json:"refs,omitempty"`
+}
+
+// nodes implement OptionsProvider to describe their current configuration in the same form their
+// factory accepts. nodes that don't are written with the options they were created with.
+type OptionsProvider interface {
+	Options() map[string]any
+}
+
+// nodes whose current configuration can't be written as options at all (e.g. they were built from go values)
+// implement OptionsChecker, and WriteScene fails for them instead of writing options that won't load
+type OptionsChecker interface {
+	CheckOptions() error
+}
+
+func LoadScene(c *State, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return LoadSceneJSON(c, raw)
+}
+
+// instantiate and Init every node in the scene on c
+func LoadSceneJSON(c *State, data []byte) error {
+	var scene Scene
+	if err := json.Unmarshal(data, &scene); err != nil {
+		return err
+	}
+
+	if c.drawing {
+		return ErrGraphBusy
+	}
+	if err := checkScene(c, &scene); err != nil {
+		return err
+	}
+
+	declared := make([]*NodeInstance, 0, len(scene.Nodes))
+
+	for _, sn := range scene.Nodes {
+		n, err := InitNode(c, &NodeOptions{
+			Type:    sn.Type,
+			Name:    sn.Name,
+			Refs:    sn.Refs,
+			Options: sn.Options,
+		})
+		if n != nil {
+			declared = append(declared, n)
+		}
+		if err != nil {
+			unloadScene(c, declared)
+			return err
+		}
+	}
+
+	for _, n := range declared {
+		if !n.ready {
+			err := ValidateGraph(c)
+			unloadScene(c, declared)
+			return err
+		}
+	}
+
+	return ValidateGraph(c)
+}
+
+// catch what would fail part way through loading: unknown types, duplicate names and refs to nodes that
+// neither the scene nor the graph has
+func checkScene(c *State, scene *Scene) error {
+	var errs []error
+
+	names := make(map[string]bool, len(scene.Nodes))
+	for _, sn := range scene.Nodes {
+		if sn.Name == "" {
+			continue
+		}
+		if names[sn.Name] || c.graph[sn.Name] != nil {
+			errs = append(errs, fmt.Errorf("cobalt: a node named %q already exists", sn.Name))
+		}
+		names[sn.Name] = true
+	}
+
+	for _, sn := range scene.Nodes {
+		if sn.Type == "" {
+			errs = append(errs, fmt.Errorf("cobalt: scene node %q has no type", sn.Name))
+		} else if _, ok := c.nodeTypes[sn.Type]; !ok {
+			errs = append(errs, fmt.Errorf("cobalt: scene node %q: unknown node type %q", sn.Name, sn.Type))
+		}
+
+		for refName, target := range sn.Refs {
+			if !names[target] && c.graph[target] == nil {
+				errs = append(errs, fmt.Errorf("cobalt: scene node %q ref %q: no node named %q", sn.Name, refName, target))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// take the nodes of a scene that failed to load back out of the graph, newest first. nodes that failed Init
+// were already removed by the graph
+func unloadScene(c *State, declared []*NodeInstance) {
+	for _, n := range slices.Backward(declared) {
+		if c.graph[n.Name] != n {
+			continue
+		}
+
+		removeGraphNode(c, n)
+		if !n.ready {
+			continue
+		}
+		if i := slices.Index(c.Nodes, n.definition); i >= 0 {
+			c.Nodes = slices.Delete(c.Nodes, i, i+1)
+		}
+		if err := n.definition.OnDestroy(c); err != nil {
+			logger(c).Warn("node destroy failed while unloading scene", "node", n.Name, "err", err)
+		}
+	}
+}
+
+// describe the render graph on c, in render order. fails when a node can't be described by options
+// (see OptionsChecker)
+func WriteScene(c *State) (*Scene, error) {
+	scene := &Scene{}
+
+	byNode := make(map[NodeDefinition]*NodeInstance, len(c.graphOrder))
+	for _, n := range c.graphOrder {
+		byNode[n.definition] = n
+	}
+
+	written := make(map[*NodeInstance]bool, len(c.graphOrder))
+
+	var errs []error
+
+	add := func(n *NodeInstance) {
+		if ch, ok := n.definition.(OptionsChecker); ok {
+			if err := ch.CheckOptions(); err != nil {
+				errs = append(errs, fmt.Errorf("cobalt: node %q: %w", n.Name, err))
+			}
+		}
+
+		options := n.options
+		if p, ok := n.definition.(OptionsProvider); ok {
+			options = p.Options()
+		}
+		if len(options) == 0 {
+			options = nil
+		}
+
+		var refs map[string]string
+		if len(n.refs) > 0 {
+			refs = n.refs
+		}
+
+		scene.Nodes = append(scene.Nodes, SceneNode{
+			Name:    n.Name,
+			Type:    n.nodeType,
+			Options: options,
+			Refs:    refs,
+		})
+		written[n] = true
+	}
+
+	for _, node := range c.Nodes {
+		if n := byNode[node]; n != nil {
+			add(n)
+		}
+	}
+
+	// nodes still waiting on refs aren't in c.Nodes yet
+	for _, n := range c.graphOrder {
+		if !written[n] {
+			add(n)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+func MarshalScene(c *State) ([]byte, error) {
+	scene, err := WriteScene(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(scene, "", "  ")
+}
+
+func SaveScene(c *State, path string) error {
+	raw, err := MarshalScene(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+// shared by the built-in nodes' Options implementations
+
+func vec2Option(v [2]float32) []float32 {
+	return []float32{v[0], v[1]}
+}
+
+func vec4Option(v [4]float32) []float32 {
+	return []float32{v[0], v[1], v[2], v[3]}
+}
+
+func colorOption(v wgpu.Color) []float64 {
+	return []float64{v.R, v.G, v.B, v.A}
+}
+
+func loadOpOption(op wgpu.LoadOp) string {
+	if op == wgpu.LoadOpClear {
+		return "clear"
+	}
+	return "load"
+}
+
+func usageOption(usage wgpu.TextureUsage) []string {
+	var names []string
+	for _, name := range []string{"copySrc", "copyDst", "textureBinding", "storageBinding", "renderAttachment"} {
+		if usage&textureUsageNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,194 @@
+package cobalt
+
+import "math"
+
+/*
+Hit testing for sprites, e.g. editor selection or clicking units. Sprites are tested with the same geometry the
+sprite shader draws (size, scale, trimming offset and rotation), so a hit is exactly where the sprite shows up.
+
+Positions are in the node's space: world pixels, or viewport pixels for IsScreenSpace nodes. Use ScreenToWorld to
+turn a cursor position into world pixels first.
+*/
+
+type PickMode int
+
+const (
+	PickBounds PickMode = iota // anywhere inside the sprite's (rotated) quad
+	PickAlpha                  // only where the sprite is at least half opaque. needs SpritesheetNode.KeepPixels
+)
+
+// ids of the sprites at pos, topmost (last drawn) first
+func (s *SpriteNode) SpritesAt(pos [2]float32, mode PickMode) []uint32 {
+	var ids []uint32
+	for i := len(s.Sprites) - 1; i >= 0; i-- {
+		sp := &s.Sprites[i]
+		if s.hitSprite(sp, pos, mode) {
+			ids = append(ids, sp.Id)
+		}
+	}
+	return ids
+}
+
+// id of the topmost sprite at pos
+func (s *SpriteNode) SpriteAt(pos [2]float32, mode PickMode) (uint32, bool) {
+	for i := len(s.Sprites) - 1; i >= 0; i-- {
+		sp := &s.Sprites[i]
+		if s.hitSprite(sp, pos, mode) {
+			return sp.Id, true
+		}
+	}
+	return 0, false
+}
+
+// ids of the sprites overlapping the rectangle [topLeft, bottomRight], topmost first. with PickAlpha a sprite only
+// counts when one of its opaque texels is inside the rectangle
+func (s *SpriteNode) SpritesInRect(topLeft [2]float32, bottomRight [2]float32, mode PickMode) []uint32 {
+	lo := [2]float32{min(topLeft[0], bottomRight[0]), min(topLeft[1], bottomRight[1])}
+	hi := [2]float32{max(topLeft[0], bottomRight[0]), max(topLeft[1], bottomRight[1])}
+
+	var ids []uint32
+	for i := len(s.Sprites) - 1; i >= 0; i-- {
+		sp := &s.Sprites[i]
+		q, ok := s.spriteQuad(sp)
+		if !ok || !q.overlaps(lo, hi) {
+			continue
+		}
+		if mode == PickAlpha && !s.opaqueInRect(sp, q, lo, hi) {
+			continue
+		}
+		ids = append(ids, sp.Id)
+	}
+	return ids
+}
+
+// a sprite's placement, as computed in vs_main of node-sprite.wgsl
+type spriteQuad struct {
+	desc   Desc
+	pos    [2]float32
+	size   [2]float32 // signed, negative scales mirror the sprite
+	offset [2]float32 // trimming compensation, in local pixels
+	cos    float32
+	sin    float32
+}
+
+func (s *SpriteNode) spriteQuad(sp *SpriteInstance) (spriteQuad, bool) {
+	if s.Spritesheet == nil || s.Spritesheet.Spritetable == nil || int(sp.SpriteID) >= len(s.Spritesheet.Spritetable.Descs) {
+		return spriteQuad{}, false
+	}
+
+	d := s.Spritesheet.Spritetable.Descs[sp.SpriteID]
+	q := spriteQuad{
+		desc: d,
+		pos:  sp.Position,
+		size: [2]float32{
+			float32(d.FrameSize[0]) * sp.Size[0] * sp.Scale[0],
+			float32(d.FrameSize[1]) * sp.Size[1] * sp.Scale[1],
+		},
+		offset: [2]float32{d.CenterOffset[0] * sp.Scale[0], d.CenterOffset[1] * sp.Scale[1]},
+		cos:    float32(math.Cos(float64(sp.Rotation))),
+		sin:    float32(math.Sin(float64(sp.Rotation))),
+	}
+	return q, q.size[0] != 0 && q.size[1] != 0
+}
+
+// corner space (-0.5..0.5 across the quad) -> world
+func (q spriteQuad) toWorld(corner [2]float32) [2]float32 {
+	lx := corner[0]*q.size[0] + q.offset[0]
+	ly := corner[1]*q.size[1] + q.offset[1]
+	return [2]float32{lx*q.cos - ly*q.sin + q.pos[0], lx*q.sin + ly*q.cos + q.pos[1]}
+}
+
+// world -> corner space
+func (q spriteQuad) toCorner(p [2]float32) [2]float32 {
+	dx := p[0] - q.pos[0]
+	dy := p[1] - q.pos[1]
+	lx := dx*q.cos + dy*q.sin - q.offset[0]
+	ly := -dx*q.sin + dy*q.cos - q.offset[1]
+	return [2]float32{lx / q.size[0], ly / q.size[1]}
+}
+
+func (q spriteQuad) contains(p [2]float32) bool {
+	c := q.toCorner(p)
+	return c[0] >= -0.5 && c[0] <= 0.5 && c[1] >= -0.5 && c[1] <= 0.5
+}
+
+// separating axis test between the quad and the axis aligned rectangle [lo, hi]
+func (q spriteQuad) overlaps(lo [2]float32, hi [2]float32) bool {
+	corners := [4][2]float32{
+		q.toWorld([2]float32{-0.5, -0.5}),
+		q.toWorld([2]float32{0.5, -0.5}),
+		q.toWorld([2]float32{0.5, 0.5}),
+		q.toWorld([2]float32{-0.5, 0.5}),
+	}
+	rect := [4][2]float32{{lo[0], lo[1]}, {hi[0], lo[1]}, {hi[0], hi[1]}, {lo[0], hi[1]}}
+
+	axes := [4][2]float32{{1, 0}, {0, 1}, {q.cos, q.sin}, {-q.sin, q.cos}}
+	for _, axis := range axes {
+		qMin, qMax := project(corners, axis)
+		rMin, rMax := project(rect, axis)
+		if qMax < rMin || rMax < qMin {
+			return false
+		}
+	}
+	return true
+}
+
+func project(points [4][2]float32, axis [2]float32) (float32, float32) {
+	lo := float32(math.Inf(1))
+	hi := float32(math.Inf(-1))
+	for _, p := range points {
+		d := p[0]*axis[0] + p[1]*axis[1]
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	return lo, hi
+}
+
+func (s *SpriteNode) hitSprite(sp *SpriteInstance, pos [2]float32, mode PickMode) bool {
+	q, ok := s.spriteQuad(sp)
+	if !ok || !q.contains(pos) {
+		return false
+	}
+	if mode != PickAlpha {
+		return true
+	}
+	return s.opaqueAt(sp, q, q.toCorner(pos))
+}
+
+// true when the texel drawn at corner is at least half opaque (opacity included)
+func (s *SpriteNode) opaqueAt(sp *SpriteInstance, q spriteQuad, corner [2]float32) bool {
+	pixels := s.Spritesheet.Pixels
+	if pixels == nil {
+		return false
+	}
+
+	b := pixels.Bounds()
+	u := q.desc.UvOrigin[0] + q.desc.UvSpan[0]*(corner[0]+0.5)
+	v := q.desc.UvOrigin[1] + q.desc.UvSpan[1]*(corner[1]+0.5)
+
+	x := min(int(u*float32(b.Dx())), b.Dx()-1)
+	y := min(int(v*float32(b.Dy())), b.Dy()-1)
+	if x < 0 || y < 0 {
+		return false
+	}
+
+	a := float32(pixels.Pix[pixels.PixOffset(b.Min.X+x, b.Min.Y+y)+3]) / 255
+	return a*sp.Opacity >= 0.5
+}
+
+// true when one of the sprite's opaque texels has its center inside [lo, hi]
+func (s *SpriteNode) opaqueInRect(sp *SpriteInstance, q spriteQuad, lo [2]float32, hi [2]float32) bool {
+	fw, fh := q.desc.FrameSize[0], q.desc.FrameSize[1]
+	for ty := 0; ty < fh; ty++ {
+		for tx := 0; tx < fw; tx++ {
+			corner := [2]float32{(float32(tx)+0.5)/float32(fw) - 0.5, (float32(ty)+0.5)/float32(fh) - 0.5}
+			p := q.toWorld(corner)
+			if p[0] < lo[0] || p[0] > hi[0] || p[1] < lo[1] || p[1] > hi[1] {
+				continue
+			}
+			if s.opaqueAt(sp, q, corner) {
+				return true
+			}
+		}
+	}
+	return false
+}
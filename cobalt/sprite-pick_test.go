@@ -0,0 +1,210 @@
+package cobalt
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+)
+
+// an 8x4 sheet with two 4x4 frames. frame 0 is transparent in its left half, frame 1 is opaque and its center is
+// shifted 2 pixels to the right
+func testSpritesheet() *SpritesheetNode {
+	pixels := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			a := uint8(255)
+			if x < 2 {
+				a = 0
+			}
+			pixels.SetRGBA(x, y, color.RGBA{A: a})
+		}
+	}
+
+	return &SpritesheetNode{
+		Spritetable: &SpriteTable{
+			Descs: []Desc{
+				{UvOrigin: [2]float32{0, 0}, UvSpan: [2]float32{0.5, 1}, FrameSize: [2]int{4, 4}},
+				{UvOrigin: [2]float32{0.5, 0}, UvSpan: [2]float32{0.5, 1}, FrameSize: [2]int{4, 4}, CenterOffset: [2]float32{2, 0}},
+			},
+		},
+		Pixels: pixels,
+	}
+}
+
+// a 16x16 world pixel sprite
+func testSprite(id uint32, spriteID uint32, pos [2]float32) SpriteInstance {
+	return SpriteInstance{
+		Id:       id,
+		SpriteID: spriteID,
+		Position: pos,
+		Size:     [2]float32{1, 1},
+		Scale:    [2]float32{4, 4},
+		Opacity:  1,
+	}
+}
+
+func TestSpriteAtGeometry(t *testing.T) {
+	tests := []struct {
+		name   string
+		sprite func() SpriteInstance
+		pos    [2]float32
+		mode   PickMode
+		hit    bool
+	}{
+		{"center", func() SpriteInstance { return testSprite(1, 0, [2]float32{0, 0}) }, [2]float32{0, 0}, PickBounds, true},
+		{"on the edge", func() SpriteInstance { return testSprite(1, 0, [2]float32{0, 0}) }, [2]float32{8, 0}, PickBounds, true},
+		{"past the edge", func() SpriteInstance { return testSprite(1, 0, [2]float32{0, 0}) }, [2]float32{9, 0}, PickBounds, false},
+		{"size multiplies the frame", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Size = [2]float32{2, 1}
+			return sp
+		}, [2]float32{15, 0}, PickBounds, true},
+		{"rotated corner reaches past the unrotated bounds", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{100, 0})
+			sp.Rotation = math.Pi / 4
+			return sp
+		}, [2]float32{110, 0}, PickBounds, true},
+		{"rotated quad misses its old corner", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{100, 0})
+			sp.Rotation = math.Pi / 4
+			return sp
+		}, [2]float32{107, 7}, PickBounds, false},
+		{"center offset shifts the quad", func() SpriteInstance { return testSprite(1, 1, [2]float32{0, 0}) }, [2]float32{12, 0}, PickBounds, true},
+		{"center offset leaves the left side", func() SpriteInstance { return testSprite(1, 1, [2]float32{0, 0}) }, [2]float32{-4, 0}, PickBounds, false},
+		{"unknown sprite id", func() SpriteInstance { return testSprite(1, 7, [2]float32{0, 0}) }, [2]float32{0, 0}, PickBounds, false},
+		{"zero scale", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Scale = [2]float32{0, 4}
+			return sp
+		}, [2]float32{0, 0}, PickBounds, false},
+
+		{"alpha, transparent half", func() SpriteInstance { return testSprite(1, 0, [2]float32{0, 0}) }, [2]float32{-4, 0}, PickAlpha, false},
+		{"alpha, opaque half", func() SpriteInstance { return testSprite(1, 0, [2]float32{0, 0}) }, [2]float32{4, 0}, PickAlpha, true},
+		{"alpha, mirrored sprite flips the halves", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Scale = [2]float32{-4, 4}
+			return sp
+		}, [2]float32{4, 0}, PickAlpha, false},
+		{"alpha, mirrored opaque half", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Scale = [2]float32{-4, 4}
+			return sp
+		}, [2]float32{-4, 0}, PickAlpha, true},
+		{"alpha, faded sprite", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Opacity = 0.4
+			return sp
+		}, [2]float32{4, 0}, PickAlpha, false},
+		{"bounds ignore opacity", func() SpriteInstance {
+			sp := testSprite(1, 0, [2]float32{0, 0})
+			sp.Opacity = 0.4
+			return sp
+		}, [2]float32{-4, 0}, PickBounds, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SpriteNode{Spritesheet: testSpritesheet(), Sprites: []SpriteInstance{tt.sprite()}}
+			_, hit := s.SpriteAt(tt.pos, tt.mode)
+			if hit != tt.hit {
+				t.Errorf("SpriteAt(%v) hit = %v, want %v", tt.pos, hit, tt.hit)
+			}
+		})
+	}
+}
+
+func TestPickAlphaWithoutPixels(t *testing.T) {
+	sheet := testSpritesheet()
+	sheet.Pixels = nil
+	s := &SpriteNode{Spritesheet: sheet, Sprites: []SpriteInstance{testSprite(1, 0, [2]float32{0, 0})}}
+
+	if _, hit := s.SpriteAt([2]float32{4, 0}, PickAlpha); hit {
+		t.Error("PickAlpha hit a sprite without KeepPixels")
+	}
+	if _, hit := s.SpriteAt([2]float32{4, 0}, PickBounds); !hit {
+		t.Error("PickBounds missed the sprite")
+	}
+}
+
+func TestSpritesAtDrawOrder(t *testing.T) {
+	mirrored := testSprite(30, 0, [2]float32{0, 0})
+	mirrored.Scale = [2]float32{-4, 4}
+
+	s := &SpriteNode{
+		Spritesheet: testSpritesheet(),
+		Sprites: []SpriteInstance{
+			testSprite(10, 1, [2]float32{-8, 0}),
+			testSprite(20, 0, [2]float32{0, 0}),
+			mirrored,
+			testSprite(40, 0, [2]float32{50, 50}),
+		},
+	}
+
+	tests := []struct {
+		name string
+		pos  [2]float32
+		mode PickMode
+		ids  []uint32
+	}{
+		{"topmost first", [2]float32{4, 0}, PickBounds, []uint32{30, 20, 10}},
+		{"alpha skips the transparent top sprite", [2]float32{4, 0}, PickAlpha, []uint32{20, 10}},
+		{"alpha hits the mirrored top sprite", [2]float32{-4, 0}, PickAlpha, []uint32{30, 10}},
+		{"nothing there", [2]float32{30, 30}, PickBounds, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.SpritesAt(tt.pos, tt.mode); !slices.Equal(got, tt.ids) {
+				t.Errorf("SpritesAt(%v) = %v, want %v", tt.pos, got, tt.ids)
+			}
+
+			id, ok := s.SpriteAt(tt.pos, tt.mode)
+			if len(tt.ids) == 0 {
+				if ok {
+					t.Errorf("SpriteAt(%v) = %v, want no hit", tt.pos, id)
+				}
+			} else if !ok || id != tt.ids[0] {
+				t.Errorf("SpriteAt(%v) = %v, %v, want %v", tt.pos, id, ok, tt.ids[0])
+			}
+		})
+	}
+}
+
+func TestSpritesInRect(t *testing.T) {
+	rotated := testSprite(2, 0, [2]float32{100, 0})
+	rotated.Rotation = math.Pi / 4
+
+	s := &SpriteNode{
+		Spritesheet: testSpritesheet(),
+		Sprites: []SpriteInstance{
+			testSprite(1, 0, [2]float32{0, 0}),
+			rotated,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		topLeft     [2]float32
+		bottomRight [2]float32
+		mode        PickMode
+		ids         []uint32
+	}{
+		{"everything, topmost first", [2]float32{-20, -20}, [2]float32{120, 20}, PickBounds, []uint32{2, 1}},
+		{"corners in either order", [2]float32{120, 20}, [2]float32{-20, -20}, PickBounds, []uint32{2, 1}},
+		{"inside the rotated bounding box but off the quad", [2]float32{108, -8}, [2]float32{112, -4}, PickBounds, nil},
+		{"touching the rotated quad", [2]float32{105, -3}, [2]float32{112, 3}, PickBounds, []uint32{2}},
+		{"alpha, only transparent texels inside", [2]float32{-8, -8}, [2]float32{-1, 8}, PickAlpha, nil},
+		{"alpha, an opaque texel inside", [2]float32{-8, -8}, [2]float32{3, 8}, PickAlpha, []uint32{1}},
+		{"bounds, transparent part", [2]float32{-8, -8}, [2]float32{-1, 8}, PickBounds, []uint32{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.SpritesInRect(tt.topLeft, tt.bottomRight, tt.mode); !slices.Equal(got, tt.ids) {
+				t.Errorf("SpritesInRect(%v, %v) = %v, want %v", tt.topLeft, tt.bottomRight, got, tt.ids)
+			}
+		})
+	}
+}
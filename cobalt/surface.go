@@ -0,0 +1,250 @@
+package cobalt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+// errors returned from Draw when the next frame can't be acquired. the binding only reports these as
+// message strings, so they're classified by text (see surfaceError).
+var (
+	// recoverable: the frame was skipped, keep calling Draw
+	ErrSurfaceTimeout  = errors.New("cobalt: surface timed out")
+	ErrSurfaceOutdated = errors.New("cobalt: surface is outdated")
+	ErrSurfaceLost     = errors.New("cobalt: surface was lost")
+
+	// fatal
+	ErrOutOfMemory = errors.New("cobalt: out of memory")
+	ErrDeviceLost  = errors.New("cobalt: device was lost")
+)
+
+// true for surface errors where the frame was skipped and rendering can simply continue
+func IsRecoverable(err error) bool {
+	return errors.Is(err, ErrSurfaceTimeout) || errors.Is(err, ErrSurfaceOutdated) || errors.Is(err, ErrSurfaceLost)
+}
+
+// wrap a GetCurrentTexture error in the matching sentinel. unknown errors are returned as is
+func surfaceError(err error) error {
+	msg := strings.ToLower(err.Error())
+
+	var sentinel error
+	switch {
+	case strings.Contains(msg, "timed out") || strings.Contains(msg, "timeout"):
+		sentinel = ErrSurfaceTimeout
+	case strings.Contains(msg, "outdated"):
+		sentinel = ErrSurfaceOutdated
+	case strings.Contains(msg, "device") && strings.Contains(msg, "lost"):
+		sentinel = ErrDeviceLost
+	case strings.Contains(msg, "lost"):
+		sentinel = ErrSurfaceLost
+	case strings.Contains(msg, "out of memory") || strings.Contains(msg, "no more memory"):
+		sentinel = ErrOutOfMemory
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", sentinel, err)
+}
+
+// a surface texture acquired for one Draw
+type frame interface {
+	view() *wgpu.TextureView
+	// hand the texture back to the surface. abandoned frames are cleared first, their content is incomplete
+	present(c *State, abandoned bool)
+	release()
+}
+
+type surfaceFrame struct {
+	texture *wgpu.Texture
+	target  *wgpu.TextureView
+}
+
+func acquireFrame(c *State) (frame, error) {
+	texture, err := c.surface.GetCurrentTexture()
+	if err != nil {
+		err = surfaceError(err)
+
+		// the swapchain no longer matches the window, reconfigure it and skip this frame
+		if errors.Is(err, ErrSurfaceOutdated) || errors.Is(err, ErrSurfaceLost) {
+			configureSurface(c)
+		}
+		return nil, err
+	}
+
+	view, err := texture.CreateView(nil)
+	if err != nil {
+		// the texture still has to go back to the surface
+		c.surface.Present()
+		texture.Release()
+		return nil, err
+	}
+
+	return &surfaceFrame{texture: texture, target: view}, nil
+}
+
+func (f *surfaceFrame) view() *wgpu.TextureView {
+	return f.target
+}
+
+func (f *surfaceFrame) present(c *State, abandoned bool) {
+	if abandoned {
+		if err := clearView(c, f.target); err != nil {
+			logger(c).Error("clearing an abandoned frame failed", "err", err)
+		}
+	}
+	c.surface.Present()
+}
+
+func (f *surfaceFrame) release() {
+	f.target.Release()
+	f.texture.Release()
+}
+
+// submit a pass that only clears view to black
+func clearView(c *State, view *wgpu.TextureView) error {
+	encoder, err := c.Device.CreateCommandEncoder(nil)
+	if err != nil {
+		return err
+	}
+	defer encoder.Release()
+
+	pass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
+		Label: "abandoned frame clear",
+		ColorAttachments: []wgpu.RenderPassColorAttachment{
+			{
+				View:       view,
+				ClearValue: wgpu.Color{A: 1},
+				LoadOp:     wgpu.LoadOpClear,
+				StoreOp:    wgpu.StoreOpStore,
+			},
+		},
+	})
+	err = pass.End()
+	pass.Release()
+	if err != nil {
+		return err
+	}
+
+	cmdBuffer, err := encoder.Finish(nil)
+	if err != nil {
+		return err
+	}
+	defer cmdBuffer.Release()
+
+	c.Queue.Submit(cmdBuffer)
+	return nil
+}
+
+// configure the surface for the window's current framebuffer size (physical pixels).
+// skipped while the window is minimized, since a zero sized surface can't be configured.
+func configureSurface(c *State) {
+	fbWidth, fbHeight := c.window.GetFramebufferSize()
+	if fbWidth <= 0 || fbHeight <= 0 {
+		return
+	}
+
+	c.Config.Width = uint32(fbWidth)
+	c.Config.Height = uint32(fbHeight)
+	c.surface.Configure(c.adapter, c.Device, c.Config)
+}
+
+// returned when the requested surface options aren't in the surface capabilities
+var ErrUnsupportedSurface = errors.New("cobalt: unsupported surface option")
+
+type SurfaceOptions struct {
+	// PresentModeFifo (vsync, the default and always available), PresentModeMailbox (vsync without waiting,
+	// lowest latency) or PresentModeImmediate (no vsync, may tear)
+	PresentMode wgpu.PresentMode
+
+	// surface formats in order of preference, the first supported one is used. empty picks BGRA8Unorm when
+	// available. with an sRGB format the hardware encodes colors on write, so shaders output linear colors.
+	// RGBA16Float is an HDR surface on platforms that support one
+	Formats []wgpu.TextureFormat
+}
+
+// nodes with pipelines that target the surface implement this to rebuild them when SetSurfaceOptions
+// changes the surface format
+type NodeFormatHooks interface {
+	OnSurfaceFormat(*State) error
+}
+
+// what the window surface supports on this adapter
+func SurfaceCapabilities(c *State) wgpu.SurfaceCapabilities {
+	return c.caps
+}
+
+// change the present mode and/or surface format while running. nodes implementing NodeFormatHooks are
+// rebuilt when the format changes
+func SetSurfaceOptions(c *State, opts SurfaceOptions) error {
+	if c.drawing {
+		return ErrGraphBusy
+	}
+
+	format, presentMode, err := chooseSurface(c.caps, opts)
+	if err != nil {
+		return err
+	}
+
+	changed := format != c.Config.Format
+	logger(c).Debug("set surface options", "format", format, "presentMode", presentMode)
+
+	c.Config.Format = format
+	c.Config.PresentMode = presentMode
+	configureSurface(c)
+
+	if !changed {
+		return nil
+	}
+
+	var errs NodeErrors
+	for _, n := range c.Nodes {
+		hooks, ok := n.(NodeFormatHooks)
+		if !ok {
+			continue
+		}
+		if err := hooks.OnSurfaceFormat(c); err != nil {
+			errs = append(errs, newNodeError(c, n, PhaseFormat, err))
+		}
+	}
+	return errs.err()
+}
+
+// vsync on is PresentModeFifo. off prefers Mailbox, which doesn't tear, and falls back to Immediate
+func SetVSync(c *State, enabled bool) error {
+	opts := SurfaceOptions{PresentMode: wgpu.PresentModeFifo, Formats: []wgpu.TextureFormat{c.Config.Format}}
+	if !enabled {
+		opts.PresentMode = wgpu.PresentModeImmediate
+		if slices.Contains(c.caps.PresentModes, wgpu.PresentModeMailbox) {
+			opts.PresentMode = wgpu.PresentModeMailbox
+		}
+	}
+	return SetSurfaceOptions(c, opts)
+}
+
+// validate opts against the surface capabilities
+func chooseSurface(caps wgpu.SurfaceCapabilities, opts SurfaceOptions) (wgpu.TextureFormat, wgpu.PresentMode, error) {
+	if len(caps.Formats) == 0 || len(caps.AlphaModes) == 0 {
+		return 0, 0, fmt.Errorf("%w: the surface isn't supported by this adapter", ErrUnsupportedSurface)
+	}
+
+	if !slices.Contains(caps.PresentModes, opts.PresentMode) {
+		return 0, 0, fmt.Errorf("%w: present mode %s (supported: %v)", ErrUnsupportedSurface, opts.PresentMode, caps.PresentModes)
+	}
+
+	formats := opts.Formats
+	if len(formats) == 0 {
+		// what cobalt has always rendered to, else whatever the surface prefers
+		formats = []wgpu.TextureFormat{wgpu.TextureFormatBGRA8Unorm, caps.Formats[0]}
+	}
+
+	for _, f := range formats {
+		if slices.Contains(caps.Formats, f) {
+			return f, opts.PresentMode, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: formats %v (supported: %v)", ErrUnsupportedSurface, formats, caps.Formats)
+}
@@ -0,0 +1,79 @@
+package cobalt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+// hands out one texture at a time, like a wgpu surface
+type testSurface struct {
+	acquired bool
+	presents int
+	cleared  int
+	released int
+}
+
+type testFrame struct {
+	s      *testSurface
+	target *wgpu.TextureView
+}
+
+func (s *testSurface) acquire() (frame, error) {
+	if s.acquired {
+		return nil, errors.New("surface image is already acquired")
+	}
+	s.acquired = true
+	return &testFrame{s: s, target: &wgpu.TextureView{}}, nil
+}
+
+func (f *testFrame) view() *wgpu.TextureView { return f.target }
+
+func (f *testFrame) present(c *State, abandoned bool) {
+	if abandoned {
+		f.s.cleared++
+	}
+	f.s.presents++
+	f.s.acquired = false
+}
+
+func (f *testFrame) release() { f.s.released++ }
+
+func TestDrawFrameAfterAbort(t *testing.T) {
+	c := &State{}
+	s := &testSurface{}
+	aborted := NodeErrors{&NodeError{Phase: PhaseRun, Err: errors.New("node failed")}}
+
+	for i, abort := range []bool{true, false, false} {
+		f, err := s.acquire()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+
+		err = drawFrame(c, f, func(view *wgpu.TextureView, errs *NodeErrors) error {
+			if c.surfaceTexView != view {
+				t.Errorf("frame %d: surfaceTexView isn't the frame's view while nodes run", i)
+			}
+			if abort {
+				*errs = append(*errs, aborted...)
+				return *errs
+			}
+			return nil
+		})
+
+		if (err != nil) != abort {
+			t.Errorf("frame %d: drawFrame() = %v, want an error %v", i, err, abort)
+		}
+		if c.surfaceTexView != nil {
+			t.Errorf("frame %d: surfaceTexView still points at the released view", i)
+		}
+		if c.drawing {
+			t.Errorf("frame %d: still drawing", i)
+		}
+	}
+
+	if s.presents != 3 || s.released != 3 || s.cleared != 1 {
+		t.Errorf("%d presents, %d releases and %d cleared frames, want 3, 3 and 1", s.presents, s.released, s.cleared)
+	}
+}
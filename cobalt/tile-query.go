@@ -0,0 +1,379 @@
+package cobalt
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"math"
+	"os"
+)
+
+/*
+CPU side tile queries for collision and gameplay.
+
+Queries read the same lookup data the layer's gpu texture was built from (`TileLayerNode.Cells`), so there's no
+need to keep a second copy of the map around. Positions are in world pixels; layers are treated as world aligned
+(ScrollScale of 1). A position maps to a cell the same way node-tile.wgsl maps PixelCoord: its distance from the
+viewport position is divided by the atlas TileScale, then the viewport position and the layer's scroll offset
+(ScrollOffset plus any ScrollVelocity drift) are added. With a TileScale other than 1 the tile under a world
+position moves as the viewport scrolls, so queries use the viewport position the atlas last uploaded, i.e. the
+main viewport once Draw is done with its views. ScreenToLayer gives the position under a screen point for parallax
+layers.
+*/
+
+type TileFlags uint32
+
+const (
+	TileSolid  TileFlags = 1 << iota // blocks movement from every side
+	TileOneWay                       // only blocks movement from above
+	TileSlope                        // surface height is interpolated between SlopeLeft and SlopeRight
+)
+
+type TileProperties struct {
+	Flags TileFlags
+	// surface height at the left and right edges of a slope tile. 0 is the bottom of the tile, 1 is the top
+	SlopeLeft  float32
+	SlopeRight float32
+}
+
+type Tile struct {
+	Cell  [2]int // column, row in the layer
+	Atlas [2]int // column, row in the tile atlas
+	ID    int    // atlas tile id, see TileAtlasNode.TileID
+	TileProperties
+}
+
+type RaycastHit struct {
+	Tile     Tile
+	Position [2]float32 // world position where the ray entered the tile
+	Normal   [2]float32 // face of the tile that was hit. zero when the ray started inside the tile
+	Distance float32
+}
+
+// the cpu side lookup data a tile layer was built from
+type tileGrid interface {
+	// atlas tile shown at cell (x, y). ok is false for empty or unknown cells
+	cellAt(x int, y int) (atlas [2]int, ok bool)
+	// the cells that can hold a tile. queries don't look outside of it
+	cellBounds() image.Rectangle
+}
+
+// tile properties json format:
+//
+//	{ "tiles": [ { "id": 12, "solid": true }, { "id": 13, "oneWay": true }, { "id": 14, "slope": [0, 1] } ] }
+type tilePropertiesDoc struct {
+	Tiles []struct {
+		ID     int       `json:"id"`
+		Solid  bool      `json:"solid"`
+		OneWay bool      `json:"oneWay"`
+		Slope  []float32 `json:"slope"`
+	} `json:"tiles"`
+}
+
+func loadTileProperties(path string) (map[int]TileProperties, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc tilePropertiesDoc
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	props := make(map[int]TileProperties, len(doc.Tiles))
+
+	for _, tp := range doc.Tiles {
+		p := TileProperties{}
+		if tp.Solid {
+			p.Flags |= TileSolid
+		}
+		if tp.OneWay {
+			p.Flags |= TileOneWay
+		}
+		if len(tp.Slope) > 0 {
+			if len(tp.Slope) != 2 {
+				return nil, errors.New("tile slope must be [left, right]")
+			}
+			p.Flags |= TileSlope
+			p.SlopeLeft = tp.Slope[0]
+			p.SlopeRight = tp.Slope[1]
+		}
+		props[tp.ID] = p
+	}
+
+	return props, nil
+}
+
+// tile ids count left to right, top to bottom across the atlas
+func (t *TileAtlasNode) TileID(atlas [2]int) int {
+	return atlas[1]*t.columns() + atlas[0]
+}
+
+func (t *TileAtlasNode) Properties(id int) TileProperties {
+	return t.TileProps[id]
+}
+
+func (t *TileAtlasNode) columns() int {
+	if t.AtlasMaterial == nil || t.TileSize == 0 {
+		return 0
+	}
+	return t.AtlasMaterial.Size.Width / t.TileSize
+}
+
+// size of one tile in world pixels
+func (t *TileAtlasNode) tileWorldSize() float32 {
+	return float32(float64(t.TileSize) * t.TileScale)
+}
+
+func (t *TileLayerNode) cellAt(x int, y int) ([2]int, bool) {
+	return rgbaCellAt(t.Cells, x, y)
+}
+
+func (t *TileLayerNode) cellBounds() image.Rectangle {
+	if t.Cells == nil {
+		return image.Rectangle{}
+	}
+	return image.Rect(0, 0, t.Cells.Bounds().Dx(), t.Cells.Bounds().Dy())
+}
+
+// tile at a world position
+func (t *TileLayerNode) TileAt(pos [2]float32) (Tile, bool) {
+	return tileAt(t, t.TileAtlas, t.scrollOffset(), pos)
+}
+
+// every non-empty tile overlapping the world space rectangle [topLeft, bottomRight]
+func (t *TileLayerNode) TilesInRect(topLeft [2]float32, bottomRight [2]float32) []Tile {
+	return tilesInRect(t, t.TileAtlas, t.scrollOffset(), topLeft, bottomRight)
+}
+
+// walk the grid from origin along dir and return the first tile whose flags intersect mask.
+// a mask of 0 matches any non-empty tile.
+func (t *TileLayerNode) Raycast(origin [2]float32, dir [2]float32, maxDist float32, mask TileFlags) (RaycastHit, bool) {
+	return raycastTiles(t, t.TileAtlas, t.scrollOffset(), origin, dir, maxDist, mask)
+}
+
+func (t *ChunkedTileLayerNode) cellAt(x int, y int) ([2]int, bool) {
+	if t.Source != nil {
+		return rgbaCellAt(t.Source, x, y)
+	}
+
+	if x < 0 || y < 0 || t.ChunkSize <= 0 {
+		return [2]int{}, false
+	}
+
+	// only resident chunks can be queried when streaming from a loader
+	chunk := t.chunks[[2]int{x / t.ChunkSize, y / t.ChunkSize}]
+	if chunk == nil {
+		return [2]int{}, false
+	}
+	return rgbaCellAt(chunk.Cells, x%t.ChunkSize, y%t.ChunkSize)
+}
+
+// the whole map for Source, the resident chunks for a Loader
+func (t *ChunkedTileLayerNode) cellBounds() image.Rectangle {
+	size := image.Rect(0, 0, t.MapSize[0], t.MapSize[1])
+	if t.Source != nil {
+		return size
+	}
+
+	var loaded image.Rectangle
+	for key := range t.chunks {
+		n := t.ChunkSize
+		loaded = loaded.Union(image.Rect(key[0]*n, key[1]*n, (key[0]+1)*n, (key[1]+1)*n))
+	}
+	if t.MapSize[0] > 0 && t.MapSize[1] > 0 {
+		loaded = loaded.Intersect(size)
+	}
+	return loaded
+}
+
+// tile at a world position. when streaming from a Loader, only loaded chunks are searched
+func (t *ChunkedTileLayerNode) TileAt(pos [2]float32) (Tile, bool) {
+	return tileAt(t, t.TileAtlas, t.ScrollOffset, pos)
+}
+
+// every non-empty tile overlapping the world space rectangle [topLeft, bottomRight]
+func (t *ChunkedTileLayerNode) TilesInRect(topLeft [2]float32, bottomRight [2]float32) []Tile {
+	return tilesInRect(t, t.TileAtlas, t.ScrollOffset, topLeft, bottomRight)
+}
+
+// walk the grid from origin along dir and return the first tile whose flags intersect mask.
+// a mask of 0 matches any non-empty tile.
+func (t *ChunkedTileLayerNode) Raycast(origin [2]float32, dir [2]float32, maxDist float32, mask TileFlags) (RaycastHit, bool) {
+	return raycastTiles(t, t.TileAtlas, t.ScrollOffset, origin, dir, maxDist, mask)
+}
+
+func rgbaCellAt(cells *image.RGBA, x int, y int) ([2]int, bool) {
+	if cells == nil {
+		return [2]int{}, false
+	}
+
+	b := cells.Bounds()
+	if x < 0 || y < 0 || x >= b.Dx() || y >= b.Dy() {
+		return [2]int{}, false
+	}
+
+	off := cells.PixOffset(b.Min.X+x, b.Min.Y+y)
+	ax, ay := cells.Pix[off], cells.Pix[off+1]
+
+	// matches the discard in node-tile.wgsl
+	if ax == 255 && ay == 255 {
+		return [2]int{}, false
+	}
+	return [2]int{int(ax), int(ay)}, true
+}
+
+// world position -> layer pixels, i.e. PixelCoord in node-tile.wgsl with a ScrollScale of 1
+func worldToLayerPixel(atlas *TileAtlasNode, offset [2]float32, pos [2]float32) [2]float32 {
+	scale := float32(atlas.TileScale)
+	view := atlas.viewPos
+
+	var p [2]float32
+	for i := 0; i < 2; i++ {
+		p[i] = (pos[i]-view[i])/scale + view[i] + offset[i]
+	}
+	return p
+}
+
+// inverse of worldToLayerPixel
+func layerPixelToWorld(atlas *TileAtlasNode, offset [2]float32, pixel [2]float32) [2]float32 {
+	scale := float32(atlas.TileScale)
+	view := atlas.viewPos
+
+	var p [2]float32
+	for i := 0; i < 2; i++ {
+		p[i] = (pixel[i]-offset[i]-view[i])*scale + view[i]
+	}
+	return p
+}
+
+func worldToCell(atlas *TileAtlasNode, offset [2]float32, pos [2]float32) [2]int {
+	p := worldToLayerPixel(atlas, offset, pos)
+	size := float32(atlas.TileSize)
+	return [2]int{
+		int(math.Floor(float64(p[0] / size))),
+		int(math.Floor(float64(p[1] / size))),
+	}
+}
+
+func makeTile(atlas *TileAtlasNode, cell [2]int, atlasCell [2]int) Tile {
+	id := atlas.TileID(atlasCell)
+	return Tile{
+		Cell:           cell,
+		Atlas:          atlasCell,
+		ID:             id,
+		TileProperties: atlas.Properties(id),
+	}
+}
+
+func tileAt(g tileGrid, atlas *TileAtlasNode, offset [2]float32, pos [2]float32) (Tile, bool) {
+	cell := worldToCell(atlas, offset, pos)
+
+	a, ok := g.cellAt(cell[0], cell[1])
+	if !ok {
+		return Tile{}, false
+	}
+	return makeTile(atlas, cell, a), true
+}
+
+func tilesInRect(g tileGrid, atlas *TileAtlasNode, offset [2]float32, topLeft [2]float32, bottomRight [2]float32) []Tile {
+	lo := worldToCell(atlas, offset, topLeft)
+	hi := worldToCell(atlas, offset, bottomRight)
+
+	// don't walk cells that can't exist. for a loader backed layer that's everything outside the resident chunks
+	r := image.Rect(lo[0], lo[1], hi[0]+1, hi[1]+1).Intersect(g.cellBounds())
+
+	var tiles []Tile
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if a, ok := g.cellAt(x, y); ok {
+				tiles = append(tiles, makeTile(atlas, [2]int{x, y}, a))
+			}
+		}
+	}
+
+	return tiles
+}
+
+// grid traversal from "A Fast Voxel Traversal Algorithm for Ray Tracing" (Amanatides & Woo)
+func raycastTiles(g tileGrid, atlas *TileAtlasNode, offset [2]float32, origin [2]float32, dir [2]float32, maxDist float32, mask TileFlags) (RaycastHit, bool) {
+	length := float32(math.Hypot(float64(dir[0]), float64(dir[1])))
+	if length == 0 || maxDist <= 0 {
+		return RaycastHit{}, false
+	}
+	dir = [2]float32{dir[0] / length, dir[1] / length}
+
+	bounds := g.cellBounds()
+	if bounds.Empty() {
+		return RaycastHit{}, false
+	}
+
+	// the grid is walked in layer pixels, the same space worldToCell uses. distances are scaled back to world
+	// pixels for tMax and tDelta, so t stays in world pixels
+	scale := float32(atlas.TileScale)
+	size := atlas.tileWorldSize()
+
+	p := worldToLayerPixel(atlas, offset, origin)
+	p = [2]float32{p[0] * scale, p[1] * scale}
+	cell := worldToCell(atlas, offset, origin)
+
+	var step [2]int
+	var tMax, tDelta [2]float32
+
+	for i := 0; i < 2; i++ {
+		switch {
+		case dir[i] > 0:
+			step[i] = 1
+			tMax[i] = (float32(cell[i]+1)*size - p[i]) / dir[i]
+			tDelta[i] = size / dir[i]
+		case dir[i] < 0:
+			step[i] = -1
+			tMax[i] = (float32(cell[i])*size - p[i]) / dir[i]
+			tDelta[i] = -size / dir[i]
+		default:
+			tMax[i] = float32(math.Inf(1))
+			tDelta[i] = float32(math.Inf(1))
+		}
+	}
+
+	var t float32
+	var normal [2]float32
+
+	for t <= maxDist {
+		if a, ok := g.cellAt(cell[0], cell[1]); ok {
+			tile := makeTile(atlas, cell, a)
+			if mask == 0 || tile.Flags&mask != 0 {
+				return RaycastHit{
+					Tile:     tile,
+					Position: [2]float32{origin[0] + dir[0]*t, origin[1] + dir[1]*t},
+					Normal:   normal,
+					Distance: t,
+				}, true
+			}
+		}
+
+		axis := 1
+		if tMax[0] < tMax[1] {
+			axis = 0
+		}
+
+		cell[axis] += step[axis]
+		t = tMax[axis]
+		tMax[axis] += tDelta[axis]
+		normal = [2]float32{}
+		normal[axis] = float32(-step[axis])
+
+		// stop once the ray has left the layer for good
+		lo, hi := bounds.Min.X, bounds.Max.X
+		if axis == 1 {
+			lo, hi = bounds.Min.Y, bounds.Max.Y
+		}
+		if (cell[axis] < lo && step[axis] < 0) || (cell[axis] >= hi && step[axis] > 0) {
+			return RaycastHit{}, false
+		}
+	}
+
+	return RaycastHit{}, false
+}
@@ -0,0 +1,103 @@
+package cobalt
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// an 8x8 layer of 16 pixel tiles. only cells (4, 2), (5, 2) and (6, 2) are set, each to the atlas tile with its own
+// coordinates
+func testTileLayer(scale float64, view [2]float32, offset [2]float32) *TileLayerNode {
+	cells := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			cells.SetRGBA(x, y, color.RGBA{R: 255, G: 255, A: 255})
+		}
+	}
+	for x := 4; x <= 6; x++ {
+		cells.SetRGBA(x, 2, color.RGBA{R: uint8(x), G: 2, A: 255})
+	}
+
+	return &TileLayerNode{
+		Cells:        cells,
+		ScrollScale:  [2]float32{1, 1},
+		ScrollOffset: offset,
+		TileAtlas:    &TileAtlasNode{TileSize: 16, TileScale: scale, viewPos: view},
+	}
+}
+
+func TestTileAtViewport(t *testing.T) {
+	tests := []struct {
+		name   string
+		scale  float64
+		view   [2]float32
+		offset [2]float32
+		pos    [2]float32
+		cell   [2]int
+		hit    bool
+	}{
+		{"unscaled layers ignore the viewport", 1, [2]float32{100, 50}, [2]float32{}, [2]float32{70, 40}, [2]int{4, 2}, true},
+		{"scaled, viewport at the origin", 2, [2]float32{}, [2]float32{}, [2]float32{160, 64}, [2]int{5, 2}, true},
+		{"scaled, moved viewport", 2, [2]float32{64, 32}, [2]float32{}, [2]float32{96, 32}, [2]int{5, 2}, true},
+		{"scaled, moved viewport and scroll offset", 2, [2]float32{64, 32}, [2]float32{16, 0}, [2]float32{96, 32}, [2]int{6, 2}, true},
+		{"scaled, just left of the first tile", 2, [2]float32{64, 32}, [2]float32{}, [2]float32{63, 32}, [2]int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testTileLayer(tt.scale, tt.view, tt.offset)
+			tile, ok := l.TileAt(tt.pos)
+			if ok != tt.hit {
+				t.Fatalf("TileAt(%v) hit = %v, want %v", tt.pos, ok, tt.hit)
+			}
+			if ok && (tile.Cell != tt.cell || tile.Atlas != tt.cell) {
+				t.Errorf("TileAt(%v) = cell %v atlas %v, want %v", tt.pos, tile.Cell, tile.Atlas, tt.cell)
+			}
+		})
+	}
+}
+
+func TestTilesInRectViewport(t *testing.T) {
+	l := testTileLayer(2, [2]float32{64, 32}, [2]float32{})
+
+	// layer pixels 64..79 x 32..39, only cell (4, 2)
+	tiles := l.TilesInRect([2]float32{64, 32}, [2]float32{95, 47})
+	if len(tiles) != 1 || tiles[0].Cell != [2]int{4, 2} {
+		t.Fatalf("TilesInRect = %+v, want only cell 4, 2", tiles)
+	}
+
+	// layer pixels 64..111, cells 4 to 6
+	if tiles := l.TilesInRect([2]float32{64, 32}, [2]float32{159, 47}); len(tiles) != 3 {
+		t.Errorf("TilesInRect found %d tiles, want 3", len(tiles))
+	}
+}
+
+func TestRaycastViewport(t *testing.T) {
+	l := testTileLayer(2, [2]float32{64, 32}, [2]float32{})
+	l.Cells.SetRGBA(4, 2, color.RGBA{R: 255, G: 255, A: 255})
+	l.Cells.SetRGBA(5, 2, color.RGBA{R: 255, G: 255, A: 255})
+
+	// starts in layer pixel 64, 36 and reaches cell 6 at layer pixel 96, world 128
+	hit, ok := l.Raycast([2]float32{64, 40}, [2]float32{1, 0}, 200, 0)
+	if !ok {
+		t.Fatal("Raycast missed")
+	}
+	if hit.Tile.Cell != [2]int{6, 2} || hit.Normal != [2]float32{-1, 0} {
+		t.Errorf("hit cell %v normal %v, want 6, 2 and -1, 0", hit.Tile.Cell, hit.Normal)
+	}
+	if !near(float64(hit.Distance), 64, 1e-3) || !nearVec(hit.Position, [2]float32{128, 40}, 1e-3) {
+		t.Errorf("hit at %v after %v, want 128, 40 after 64", hit.Position, hit.Distance)
+	}
+}
+
+func TestLayerPixelRoundTrip(t *testing.T) {
+	atlas := &TileAtlasNode{TileSize: 16, TileScale: 2, viewPos: [2]float32{64, 32}}
+	offset := [2]float32{10, -4}
+	world := [2]float32{123, -45}
+
+	got := layerPixelToWorld(atlas, offset, worldToLayerPixel(atlas, offset, world))
+	if !nearVec(got, world, 1e-3) {
+		t.Errorf("round trip of %v = %v", world, got)
+	}
+}
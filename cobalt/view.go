@@ -0,0 +1,252 @@
+package cobalt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/cogentcore/webgpu/wgpu"
+)
+
+/*
+Views render the same world more than once per frame, e.g. split-screen for local co-op:
+
+	cobalt.AddView(c, &cobalt.View{Name: "p1", Camera: cam1, Rect: [4]float32{0, 0, 0.5, 1}, Nodes: world})
+	cobalt.AddView(c, &cobalt.View{Name: "p2", Camera: cam2, Rect: [4]float32{0.5, 0, 0.5, 1}, Nodes: world})
+
+The nodes listed in a view run once per view, with c.Viewport switched to the view's (sized to its rect and
+centered on its camera) and drawing restricted to the view's rect of the render target. Node resources like the
+tile atlas and spritesheets are shared between views, only the small per-view uniforms are rewritten.
+
+Nodes that aren't in any view run once per frame as usual: the ones ordered before the first view node run before
+the views, the rest (e.g. a blit or a full screen hud) after them.
+
+A LoadOpClear in a view node clears the whole target, so it only clears in the first view and loads in the others.
+*/
+
+type View struct {
+	Name   string
+	Camera *Camera // where the view looks. nil keeps the position set with SetViewportPosition
+
+	// x, y, width, height as fractions of the render target. all zero means the whole target
+	Rect [4]float32
+
+	Zoom  float32  // 0 uses Viewport.Zoom
+	Nodes []string // graph names of the nodes rendered through this view
+}
+
+func AddView(c *State, v *View) error {
+	if c.drawing {
+		return ErrGraphBusy
+	}
+	if v == nil || v.Name == "" {
+		return errors.New("cobalt: a view needs a name")
+	}
+	if GetView(c, v.Name) != nil {
+		return fmt.Errorf("cobalt: view %q already exists", v.Name)
+	}
+
+	r := v.rect()
+	if r[0] < 0 || r[1] < 0 || r[2] <= 0 || r[3] <= 0 || r[0]+r[2] > 1 || r[1]+r[3] > 1 {
+		return fmt.Errorf("cobalt: view %q: rect %v is outside of the render target", v.Name, v.Rect)
+	}
+
+	for _, name := range v.Nodes {
+		if GetNode(c, name) == nil {
+			return fmt.Errorf("cobalt: view %q: unknown node %q", v.Name, name)
+		}
+	}
+
+	if v.Camera != nil {
+		if v.Camera.view != nil {
+			return fmt.Errorf("cobalt: view %q: camera is already used by view %q", v.Name, v.Camera.view.Name)
+		}
+		v.Camera.view = v
+	}
+
+	c.views = append(c.views, v)
+	return nil
+}
+
+func RemoveView(c *State, name string) error {
+	if c.drawing {
+		return ErrGraphBusy
+	}
+
+	i := slices.IndexFunc(c.views, func(v *View) bool { return v.Name == name })
+	if i < 0 {
+		return fmt.Errorf("cobalt: unknown view %q", name)
+	}
+
+	if cam := c.views[i].Camera; cam != nil {
+		cam.view = nil
+	}
+	c.views = slices.Delete(c.views, i, i+1)
+
+	// nodes go back to the single viewport
+	return notifyNodes(c, PhaseViewport)
+}
+
+func GetView(c *State, name string) *View {
+	for _, v := range c.views {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (v *View) rect() [4]float32 {
+	if v.Rect == [4]float32{} {
+		return [4]float32{0, 0, 1, 1}
+	}
+	return v.Rect
+}
+
+// the viewport nodes see while this view renders
+func (v *View) viewport(base Viewport) Viewport {
+	r := v.rect()
+
+	vp := base
+	vp.width = max(int(math.Round(float64(float32(base.width)*r[2]))), 1)
+	vp.height = max(int(math.Round(float64(float32(base.height)*r[3]))), 1)
+	if v.Zoom > 0 {
+		vp.Zoom = v.Zoom
+	}
+	if v.Camera != nil {
+		vp.center = v.Camera.center()
+	}
+	return vp
+}
+
+// the viewport of every view, or just c.Viewport when there are none. used by nodes that keep state for
+// everything visible this frame (e.g. resident tile chunks) rather than for the view being drawn
+func viewports(c *State) []Viewport {
+	if len(c.views) == 0 {
+		return []Viewport{c.Viewport}
+	}
+
+	base := c.Viewport
+	if c.activeView != nil {
+		base = c.viewBase
+	}
+
+	out := make([]Viewport, len(c.views))
+	for i, v := range c.views {
+		out[i] = v.viewport(base)
+	}
+	return out
+}
+
+// the active view's area of a render target size pixels in size, as x, y, width, height.
+// the whole target when no view is rendering
+func viewArea(c *State, size [2]int) [4]uint32 {
+	if c.activeView == nil {
+		return [4]uint32{0, 0, uint32(size[0]), uint32(size[1])}
+	}
+
+	r := c.activeView.rect()
+	x0 := math.Round(float64(r[0]) * float64(size[0]))
+	y0 := math.Round(float64(r[1]) * float64(size[1]))
+	x1 := math.Round(float64(r[0]+r[2]) * float64(size[0]))
+	y1 := math.Round(float64(r[1]+r[3]) * float64(size[1]))
+
+	return [4]uint32{uint32(x0), uint32(y0), uint32(max(x1-x0, 1)), uint32(max(y1-y0, 1))}
+}
+
+// restrict a render pass to the active view. does nothing outside of views
+func applyView(c *State, pass *wgpu.RenderPassEncoder, size [2]int) {
+	if c.activeView == nil {
+		return
+	}
+
+	a := viewArea(c, size)
+	pass.SetViewport(float32(a[0]), float32(a[1]), float32(a[2]), float32(a[3]), 0, 1)
+	pass.SetScissorRect(a[0], a[1], a[2], a[3])
+}
+
+// clearing ignores the scissor rect, so only the first view may clear
+func viewLoadOp(c *State, op wgpu.LoadOp) wgpu.LoadOp {
+	if c.activeView != nil && c.viewIndex > 0 && op == wgpu.LoadOpClear {
+		return wgpu.LoadOpLoad
+	}
+	return op
+}
+
+// called by Draw when views exist: the nodes before the views, each view, then the remaining nodes,
+// each group in its own submit so the per-view uniform writes land before the passes that read them
+func drawViews(c *State, target *wgpu.TextureView, errs *NodeErrors) error {
+	inView := make(map[NodeDefinition]bool)
+	for _, v := range c.views {
+		for _, name := range v.Nodes {
+			if n := c.graph[name]; n != nil && n.ready {
+				inView[n.definition] = true
+			}
+		}
+	}
+
+	first := slices.IndexFunc(c.Nodes, func(n NodeDefinition) bool { return inView[n] })
+	if first < 0 {
+		first = len(c.Nodes)
+	}
+
+	var before, after []NodeDefinition
+	for i, n := range c.Nodes {
+		switch {
+		case inView[n]:
+		case i < first:
+			before = append(before, n)
+		default:
+			after = append(after, n)
+		}
+	}
+
+	if err := submitNodes(c, before, target, errs); err != nil {
+		return err
+	}
+
+	base := c.Viewport
+	c.viewBase = base
+
+	var err error
+	for i, v := range c.views {
+		c.Viewport = v.viewport(base)
+		c.activeView, c.viewIndex = v, i
+
+		appendNodeErrors(errs, notifyNodes(c, PhaseViewport))
+
+		if err = submitNodes(c, viewNodes(c, v), target, errs); err != nil {
+			break
+		}
+	}
+
+	c.Viewport = base
+	c.activeView, c.viewIndex = nil, 0
+	appendNodeErrors(errs, notifyNodes(c, PhaseViewport))
+
+	if err != nil {
+		return err
+	}
+	return submitNodes(c, after, target, errs)
+}
+
+// the view's nodes, in render order
+func viewNodes(c *State, v *View) []NodeDefinition {
+	var out []NodeDefinition
+	for _, n := range c.Nodes {
+		for _, name := range v.Nodes {
+			if inst := c.graph[name]; inst != nil && inst.definition == n {
+				out = append(out, n)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func appendNodeErrors(errs *NodeErrors, err error) {
+	if ne, ok := err.(NodeErrors); ok {
+		*errs = append(*errs, ne...)
+	}
+}
@@ -0,0 +1,89 @@
+package cobalt
+
+import "github.com/go-gl/glfw/v3.3/glfw"
+
+/*
+The window has two sizes: logical points (what glfw reports for the window and the cursor) and physical pixels
+(the framebuffer the surface renders into). The content scale is the ratio between them, and changes when the
+window moves to a monitor with a different DPI. The viewport dimensions set with SetViewportDimensions are
+independent of both: they're the game resolution.
+
+Init installs glfw callbacks that reconfigure the surface whenever the framebuffer size or content scale changes,
+and sends OnResize to every node so anything sized to the physical resolution (e.g. a FrameBufferNode with
+PhysicalSize) is rebuilt. Callbacks installed on the window before Init keep being called. An app that installs
+its own framebuffer size or content scale callback after Init should call WindowChanged from it.
+*/
+
+// window size in logical points
+func WindowSize(c *State) [2]int {
+	w, h := c.window.GetSize()
+	return [2]int{w, h}
+}
+
+// surface size in physical pixels
+func FramebufferSize(c *State) [2]int {
+	return [2]int{int(c.Config.Width), int(c.Config.Height)}
+}
+
+// physical pixels per logical point, e.g. 2 on most Retina displays
+func ContentScale(c *State) [2]float32 {
+	return c.contentScale
+}
+
+func watchWindow(c *State) {
+	c.contentScale = contentScale(c.window)
+
+	var prevScale glfw.ContentScaleCallback
+	prevScale = c.window.SetContentScaleCallback(func(w *glfw.Window, x float32, y float32) {
+		if err := WindowChanged(c); err != nil {
+			logger(c).Error("content scale change failed", "err", err)
+		}
+		if prevScale != nil {
+			prevScale(w, x, y)
+		}
+	})
+
+	var prevSize glfw.FramebufferSizeCallback
+	prevSize = c.window.SetFramebufferSizeCallback(func(w *glfw.Window, width int, height int) {
+		if err := WindowChanged(c); err != nil {
+			logger(c).Error("framebuffer resize failed", "err", err)
+		}
+		if prevSize != nil {
+			prevSize(w, width, height)
+		}
+	})
+}
+
+// pick up a new framebuffer size or content scale: reconfigure the surface and resize the nodes.
+// does nothing when neither changed or while the window is minimized
+func WindowChanged(c *State) error {
+	scale := contentScale(c.window)
+	fbWidth, fbHeight := c.window.GetFramebufferSize()
+
+	// minimized. nothing is recorded, so restoring the window is picked up as a change
+	if fbWidth <= 0 || fbHeight <= 0 {
+		return nil
+	}
+
+	if scale == c.contentScale && uint32(fbWidth) == c.Config.Width && uint32(fbHeight) == c.Config.Height {
+		return nil
+	}
+
+	logger(c).Debug("window changed", "framebufferWidth", fbWidth, "framebufferHeight", fbHeight, "scaleX", scale[0], "scaleY", scale[1])
+
+	c.contentScale = scale
+	configureSurface(c)
+
+	if c.Viewport.width == 0 || c.Viewport.height == 0 {
+		return nil
+	}
+	return notifyNodes(c, PhaseResize)
+}
+
+func contentScale(w *glfw.Window) [2]float32 {
+	x, y := w.GetContentScale()
+	if x <= 0 || y <= 0 {
+		return [2]float32{1, 1}
+	}
+	return [2]float32{x, y}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	//"fmt"
-	"math"
-	//"os"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	//"strings"
@@ -15,6 +16,11 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 )
 
+const (
+	gameWidth  = 480
+	gameHeight = 270
+)
+
 type snap struct {
 	axes    []float32
 	buttons []byte // store as bytes so it works for both raw and gamepad
@@ -45,20 +51,31 @@ func main() {
 		panic(err)
 	}
 
+	// cobalt is silent unless given a logger. wgpu's own messages show up here too (see WGPU_LOG_LEVEL)
+	c.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
 	c.Viewport.Zoom = 1.0
 
-	/*
-	       fb := &cobalt.FrameBufferNode{
-	       	Label: "fb test",
-	   		Format:   c.Config.Format,
-	   		//GPUTextureUsage.RENDER_ATTACHMENT | GPUTextureUsage.STORAGE_BINDING | GPUTextureUsage.TEXTURE_BINDING
-	   		Usage:    wgpu.TextureUsageTextureBinding | wgpu.TextureUsageCopyDst | wgpu.TextureUsageRenderAttachment,
-	   		MipCount: 1,
-	       }
-
-	       _ = fb.Init(c)
-	       c.Nodes = append(c.Nodes, fb)
-	*/
+	// COBALT_HOT_RELOAD=1 rebuilds textures, spritesheets and shaders when they change on disk. the shader
+	// overrides are the ones in the cobalt source directory next to this file, wherever the example runs from
+	if os.Getenv("COBALT_HOT_RELOAD") == "1" {
+		_, file, _, _ := runtime.Caller(0)
+		shaderDir := filepath.Join(filepath.Dir(file), "..", "cobalt")
+		cobalt.EnableHotReload(c, cobalt.HotReloadOptions{ShaderDir: shaderDir})
+	}
+
+	// the game renders at gameWidth x gameHeight into fb, which the upscale node draws to the window
+	fb := &cobalt.FrameBufferNode{
+		Label:  "game",
+		Format: c.Config.Format,
+		//GPUTextureUsage.RENDER_ATTACHMENT | GPUTextureUsage.STORAGE_BINDING | GPUTextureUsage.TEXTURE_BINDING
+		Usage:    wgpu.TextureUsageTextureBinding | wgpu.TextureUsageCopyDst | wgpu.TextureUsageRenderAttachment,
+		MipCount: 1,
+	}
+
+	if _, err := cobalt.InitNode(c, &cobalt.NodeOptions{Name: "fb", Node: fb}); err != nil {
+		panic(err)
+	}
 
 	ta := &cobalt.TileAtlasNode{
 		TexturePath: "./assets/tileset.png",
@@ -67,19 +84,46 @@ func main() {
 		TileSize:    16,
 	}
 
-	_ = ta.Init(c)
-	c.Nodes = append(c.Nodes, ta)
+	if _, err := cobalt.InitNode(c, &cobalt.NodeOptions{Name: "tileAtlas", Node: ta}); err != nil {
+		panic(err)
+	}
 
 	for i := 0; i < 7; i++ {
 		tl := &cobalt.TileLayerNode{
-			TileAtlas:   ta,
 			TexturePath: "./assets/layer" + strconv.Itoa(i) + ".png",
 			Format:      wgpu.TextureFormatRGBA8Unorm,
-			ScrollScale: 1.0,
+			ScrollScale: [2]float32{1.0, 1.0},
 		}
 
-		_ = tl.Init(c)
-		c.Nodes = append(c.Nodes, tl)
+		// the bottom layer clears the previous frame
+		if i == 0 {
+			tl.LoadOp = wgpu.LoadOpClear
+		}
+
+		_, err := cobalt.InitNode(c, &cobalt.NodeOptions{
+			Name: "layer" + strconv.Itoa(i),
+			Refs: map[string]string{"tileAtlas": "tileAtlas", "target": "fb"},
+			Node: tl,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// the sprite node is declared before its spritesheet; the graph initializes it once the spritesheet exists
+	sn := &cobalt.SpriteNode{
+		Format:        wgpu.TextureFormatRGBA8Unorm,
+		IsScreenSpace: false,
+		LoadOp:        wgpu.LoadOpLoad,
+	}
+
+	_, err = cobalt.InitNode(c, &cobalt.NodeOptions{
+		Name: "sprites",
+		Refs: map[string]string{"spritesheet": "spritesheet", "target": "fb"},
+		Node: sn,
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	ss := &cobalt.SpritesheetNode{
@@ -88,42 +132,39 @@ func main() {
 		Format:              wgpu.TextureFormatRGBA8Unorm,
 	}
 
-	err2 := ss.Init(c)
-	if err2 != nil {
-		panic(err2)
+	if _, err := cobalt.InitNode(c, &cobalt.NodeOptions{Name: "spritesheet", Node: ss}); err != nil {
+		panic(err)
 	}
-	c.Nodes = append(c.Nodes, ss)
 
-	sn := &cobalt.SpriteNode{
-		Spritesheet:   ss,
-		Format:        wgpu.TextureFormatRGBA8Unorm,
-		IsScreenSpace: false,
-		LoadOp:        wgpu.LoadOpLoad,
-		//TargetFB: fb,
+	if err := cobalt.ValidateGraph(c); err != nil {
+		panic(err)
 	}
 
-	_ = sn.Init(c)
-
-	c.Nodes = append(c.Nodes, sn)
-
 	// TODO: allow passing spriteId into the function. I suspect most or all
 	// of the sprites will be created on the node side.
 	//
 	// returns a unique spriteId that can be used to modify it later
 	sid := sn.AddSprite(c, "hero_idle_look_forward-0.png", [2]float32{2400.0, 1850.0}, [2]float32{1.0, 1.0}, [4]float32{0.0, 0.0, 1.0, 0.0}, 1.0, 0.0)
 
-	/*
-		blit := &cobalt.BlitNode{
-			SourceFb: fb,
-		}
-
-		err = blit.Init(c)
+	// largest integer scale that fits the window, with black bars around it
+	_, err = cobalt.InitNode(c, &cobalt.NodeOptions{
+		Name: "upscale",
+		Refs: map[string]string{"source": "fb"},
+		Node: &cobalt.UpscaleNode{Mode: cobalt.UpscaleInteger, BarColor: wgpu.Color{A: 1}},
+	})
+	if err != nil {
+		panic(err)
+	}
 
-		if err != nil {
-			panic(err)
-		}
-		c.Nodes = append(c.Nodes, blit)
-	*/
+	// per-node timings, drawn over the game as bars. logged with the frame stats below
+	cobalt.EnableProfiling(c, cobalt.ProfileOptions{})
+	_, err = cobalt.InitNode(c, &cobalt.NodeOptions{
+		Name: "profiler",
+		Node: &cobalt.ProfilerOverlayNode{Origin: [2]float32{8, 8}},
+	})
+	if err != nil {
+		panic(err)
+	}
 
 	window.SetSizeCallback(func(w *glfw.Window, width, height int) {
 		updateWindowSize(w, c, width, height)
@@ -131,7 +172,18 @@ func main() {
 
 	updateWindowSize(window, c, 1440, 810)
 
-	cobalt.SetViewportPosition(c, [2]int{2400, 1800})
+	// the arrow keys move the point the camera follows, space shakes it
+	cam := &cobalt.Camera{
+		Target:     [2]float32{2400, 1800},
+		Follow:     cobalt.FollowSpring,
+		Frequency:  6,
+		Deadzone:   [2]float32{32, 24},
+		ShakeMax:   [2]float32{12, 8},
+		ShakeDecay: 1.5,
+	}
+	if err := cam.Snap(c); err != nil {
+		fmt.Println(err)
+	}
 
 	/*
 		prev := map[glfw.Joystick]snap{}
@@ -162,13 +214,10 @@ func main() {
 		}
 	*/
 
-	target := time.Second / 120 // cap at ~120 FPS
-
-	for !window.ShouldClose() {
-		start := time.Now()
-
-		glfw.PollEvents()
+	// the simulation runs at a fixed 60 steps per second, frames are capped at 120 FPS
+	loop := &cobalt.Loop{TickRate: 60, MaxFPS: 120}
 
+	loop.Update = func(c *cobalt.State, dt float32) error {
 		// hide the cursor when it's over the game window, otherwise show it normally:
 		// glfwSetInputMode(window, GLFW_CURSOR, GLFW_CURSOR_HIDDEN)
 
@@ -197,14 +246,33 @@ func main() {
 			sid = 0
 		}
 
-		// t0 := time.Now()
-		err := cobalt.Draw(c)
-		if err != nil {
-			panic(err)
+		const panSpeed = 300 // world pixels per second
+		if window.GetKey(glfw.KeyLeft) == glfw.Press {
+			cam.Target[0] -= panSpeed * dt
+		}
+		if window.GetKey(glfw.KeyRight) == glfw.Press {
+			cam.Target[0] += panSpeed * dt
+		}
+		if window.GetKey(glfw.KeyUp) == glfw.Press {
+			cam.Target[1] -= panSpeed * dt
+		}
+		if window.GetKey(glfw.KeyDown) == glfw.Press {
+			cam.Target[1] += panSpeed * dt
+		}
+		if window.GetKey(glfw.KeySpace) == glfw.Press {
+			cam.AddTrauma(dt * 2)
 		}
 
-		if sleep := target - time.Since(start); sleep > 0 {
-			time.Sleep(sleep)
+		// click to move the camera to the point under the cursor
+		if window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press {
+			x, y := window.GetCursorPos()
+			if world, ok := cobalt.ScreenToWorld(c, [2]float32{float32(x), float32(y)}); ok {
+				cam.Target = world
+
+				if id, ok := sn.SpriteAt(world, cobalt.PickBounds); ok {
+					c.Logger.Info("clicked sprite", "id", id)
+				}
+			}
 		}
 
 		/*
@@ -252,20 +320,31 @@ func main() {
 				fmt.Println("dt:", dt)
 			}
 
+		*/
+
+		if err := cam.Update(c, dt); err != nil {
+			fmt.Println(err)
+		}
 
-			if err != nil {
-				fmt.Println("error occured while rendering:", err)
+		return nil
+	}
 
-				errstr := err.Error()
-				switch {
-				case strings.Contains(errstr, "Surface timed out"): // do nothing
-				case strings.Contains(errstr, "Surface is outdated"): // do nothing
-				case strings.Contains(errstr, "Surface was lost"): // do nothing
-				default:
-					panic(err)
-				}
-			}
-		*/
+	// log the frame time stats every few seconds
+	lastReport := time.Now()
+	loop.Render = func(c *cobalt.State, alpha float32) error {
+		if time.Since(lastReport) < 5*time.Second {
+			return nil
+		}
+		lastReport = time.Now()
+
+		st := loop.Stats()
+		c.Logger.Info("frame stats", "avg", st.Average, "p99", st.P99, "max", st.Max, "hitches", st.Hitches, "dropped", st.Dropped)
+		fmt.Print(cobalt.ProfileReport(c))
+		return nil
+	}
+
+	if err := loop.Run(c); err != nil {
+		panic(err)
 	}
 }
 
@@ -278,24 +357,11 @@ func updateWindowSize(w *glfw.Window, c *cobalt.State, width, height int) {
 	           1792x1120
 	*/
 
-	width, height = w.GetSize() // logical points
-	idealWidth := 480.0
-
-	// scaleFactor must be an integer because we get weird texture artifacts like blurring/shimmering/uneven
-	// lines when trying to render at certain float scale values (e.g., 3.0145833333333334)
-	scaleFactor := math.Round(float64(width) / idealWidth)
-
-	if scaleFactor == 0 {
-		scaleFactor = 1
+	// the game resolution stays fixed. the surface follows the window, and the upscale node picks the
+	// largest integer scale factor that fits (scaling by fractional factors blurs and shimmers pixel art)
+	if err := cobalt.SetViewportDimensions(c, gameWidth, gameHeight); err != nil {
+		fmt.Println(err)
 	}
-
-	gameWidth := math.Round(float64(width) / scaleFactor)
-	gameHeight := math.Round(float64(height) / scaleFactor)
-
-	// renderer.canvasScale = scaleFactor
-	// c.Viewport.Zoom = int(scaleFactor)
-
-	cobalt.SetViewportDimensions(c, int(gameWidth), int(gameHeight))
 }
 
 /*